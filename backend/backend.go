@@ -0,0 +1,153 @@
+// Package backend abstracts the terminal that hosts the configured sessions.
+//
+// The tool only needs a handful of operations from a terminal: create a
+// window, split it into panes, name the panes, type into them, and check that
+// they are still around. Each supported terminal (iTerm2, tmux, or headless
+// pseudo-terminals) implements the interfaces in this file.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pglass/iterm-tool/layout"
+)
+
+const (
+	// Iterm2 drives iTerm2 through its websocket API (macOS).
+	Iterm2 = "iterm2"
+	// Tmux drives a tmux server through the tmux command line.
+	Tmux = "tmux"
+	// Pty runs headless shells on pseudo-terminals owned by the tool, logging
+	// their output to files. Useful for CI and smoke tests.
+	Pty = "pty"
+
+	// Default is used when neither the command line nor the config picks a backend.
+	Default = Iterm2
+)
+
+// Names lists the supported backends.
+var Names = []string{Iterm2, Tmux, Pty}
+
+// Backend is a connection to a terminal.
+type Backend interface {
+	io.Closer
+
+	// CreateWindow creates a new window with one tab and one pane.
+	CreateWindow(ctx context.Context, title string) (Window, error)
+	// CloseWindow closes the window with the given id.
+	// It is not an error if the window no longer exists.
+	CloseWindow(ctx context.Context, id string) error
+	// FindWindow returns the window with the given id, or nil if it no
+	// longer exists.
+	FindWindow(ctx context.Context, id string) (Window, error)
+}
+
+// Window is a top-level window holding one or more tabs.
+type Window interface {
+	ID() string
+	ListTabs(ctx context.Context) ([]Tab, error)
+	CreateTab(ctx context.Context) (Tab, error)
+}
+
+// Tab holds one or more panes.
+type Tab interface {
+	ID() string
+	SetTitle(ctx context.Context, title string) error
+	ListPanes(ctx context.Context) ([]Pane, error)
+}
+
+// Pane is a single terminal running a shell.
+type Pane interface {
+	ID() string
+	// Split creates a new pane next to this one. A vertical split places the
+	// new pane to the right, otherwise it goes below.
+	Split(ctx context.Context, vertical bool) (Pane, error)
+	SetName(ctx context.Context, name string) error
+	// Name returns the name set with SetName.
+	Name(ctx context.Context) (string, error)
+	// SendText types the text into the pane, as if it were typed by a user.
+	SendText(ctx context.Context, text string) error
+	// Alive returns an error if the pane was closed.
+	Alive(ctx context.Context) error
+	// Close closes the pane, and stops what it is running.
+	Close(ctx context.Context) error
+}
+
+// CommandRunner is implemented by panes that can tell when a command
+// finishes, such as iTerm2 panes with shell integration.
+type CommandRunner interface {
+	// CanRunCommands reports whether RunCommand works in this pane right now.
+	CanRunCommands(ctx context.Context) (bool, error)
+	// RunCommand types command into the pane and waits for it to finish.
+	RunCommand(ctx context.Context, command string) (CommandResult, error)
+}
+
+// ScreenReader is implemented by panes whose output can be read back.
+type ScreenReader interface {
+	// ScreenOffset returns where the pane's next output goes, to pass to
+	// ReadScreen. What offsets count, lines or bytes, depends on the
+	// backend.
+	ScreenOffset(ctx context.Context) (int64, error)
+	// ReadScreen returns the pane's output from offset on, as text. Lines
+	// that were too long for the pane are joined back together. At most
+	// screenLines lines are returned, the last ones.
+	ReadScreen(ctx context.Context, offset int64) (string, error)
+}
+
+// JobReader is implemented by panes that can tell what program is running
+// in them.
+type JobReader interface {
+	// Job returns the name of the program in the foreground of the pane,
+	// like the shell itself when it is idle.
+	Job(ctx context.Context) (string, error)
+}
+
+// Restarter is implemented by panes whose shell can be started over in place.
+type Restarter interface {
+	// Restart kills the pane's shell, along with whatever it runs, and
+	// starts a new shell in the same pane. It works on panes whose shell
+	// has exited, as long as the pane is still open.
+	Restart(ctx context.Context) error
+}
+
+// Resizer is implemented by tabs whose panes can be resized.
+type Resizer interface {
+	// Resize sizes the panes of the tab to the layout they were split into.
+	// panes maps each session in root to its pane.
+	Resize(ctx context.Context, root *layout.Node, panes map[string]Pane) error
+}
+
+// screenLines is how many lines of output ReadScreen returns, at most.
+const screenLines = 1000
+
+// CommandResult describes a finished command.
+type CommandResult struct {
+	ExitStatus int
+	End        time.Time
+}
+
+// Options are passed to every backend. Backends ignore options that do not apply to them.
+type Options struct {
+	// AppName is the name the tool registers with the terminal, if the terminal cares.
+	AppName string
+	// LogDir is where the pty backend writes session output.
+	// Defaults to a directory under os.TempDir() named after the window title.
+	LogDir string
+}
+
+// New connects to the backend with the given name.
+func New(name string, opts Options) (Backend, error) {
+	switch name {
+	case Iterm2:
+		return newIterm2(opts)
+	case Tmux:
+		return newTmux(opts)
+	case Pty:
+		return newPty(opts)
+	default:
+		return nil, fmt.Errorf("unknown backend %q (expected one of %v)", name, Names)
+	}
+}
@@ -0,0 +1,327 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pglass/iterm-tool/iterm2"
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"github.com/pglass/iterm-tool/layout"
+	"google.golang.org/protobuf/proto"
+)
+
+var sessionProps = iterm2.CustomProfileProperties{
+	TitleComponents: iterm2.TitleComponentSessionName,
+}
+
+type iterm2Backend struct {
+	app iterm2.App
+}
+
+func newIterm2(opts Options) (*iterm2Backend, error) {
+	app, err := iterm2.NewApp(opts.AppName)
+	if err != nil {
+		return nil, err
+	}
+	return &iterm2Backend{app: app}, nil
+}
+
+func (b *iterm2Backend) Close() error {
+	return b.app.Close()
+}
+
+func (b *iterm2Backend) CreateWindow(ctx context.Context, title string) (Window, error) {
+	w, err := b.app.CreateWindow(ctx, &iterm2.CreateWindowOpts{
+		CustomProfileProperties: sessionProps,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.SetTitle(ctx, title); err != nil {
+		return nil, fmt.Errorf("set window title: %w", err)
+	}
+	return &iterm2Window{w: w}, nil
+}
+
+func (b *iterm2Backend) CloseWindow(ctx context.Context, id string) error {
+	windows, err := b.app.ListWindows(ctx)
+	if err != nil {
+		return err
+	}
+	for _, w := range windows {
+		if w.ID() == id {
+			return w.Close(ctx, true)
+		}
+	}
+	return nil
+}
+
+func (b *iterm2Backend) FindWindow(ctx context.Context, id string) (Window, error) {
+	windows, err := b.app.ListWindows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		if w.ID() == id {
+			return &iterm2Window{w: w}, nil
+		}
+	}
+	return nil, nil
+}
+
+type iterm2Window struct {
+	w iterm2.Window
+}
+
+func (w *iterm2Window) ID() string {
+	return w.w.ID()
+}
+
+func (w *iterm2Window) ListTabs(ctx context.Context) ([]Tab, error) {
+	tabs, err := w.w.ListTabs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []Tab
+	for _, t := range tabs {
+		result = append(result, &iterm2Tab{t: t})
+	}
+	return result, nil
+}
+
+func (w *iterm2Window) CreateTab(ctx context.Context) (Tab, error) {
+	t, err := w.w.CreateTab(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &iterm2Tab{t: t}, nil
+}
+
+type iterm2Tab struct {
+	t iterm2.Tab
+}
+
+func (t *iterm2Tab) ID() string {
+	return t.t.ID()
+}
+
+func (t *iterm2Tab) SetTitle(ctx context.Context, title string) error {
+	return t.t.SetTitle(ctx, title)
+}
+
+func (t *iterm2Tab) ListPanes(ctx context.Context) ([]Pane, error) {
+	sessions, err := t.t.ListSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []Pane
+	for _, s := range sessions {
+		result = append(result, &iterm2Pane{s: s})
+	}
+	return result, nil
+}
+
+// Resize sets the grid size of every session in the tab, dividing the tab's
+// size among the layout's entries by their sizes.
+func (t *iterm2Tab) Resize(ctx context.Context, root *layout.Node, panes map[string]Pane) error {
+	tree, err := t.t.Layout(ctx)
+	if err != nil {
+		return err
+	}
+	// Entries are matched to the nodes of the split tree by the panes in
+	// them, since iTerm2 keeps its own tree of splits.
+	weights := map[string]float64{}
+	root.Flatten().Walk(func(n *layout.Node) {
+		var ids []string
+		for _, session := range n.Sessions() {
+			if pane, ok := panes[session]; ok {
+				ids = append(ids, pane.ID())
+			}
+		}
+		weights[paneSetKey(ids)] = n.Weight()
+	})
+	width, height := splitTreeSize(tree)
+	resizeSplitTree(tree, width, height, weights)
+	return t.t.SetLayout(ctx, tree)
+}
+
+// resizeSplitTree divides width or height among the links of n, by the
+// weights of the panes under them.
+func resizeSplitTree(n *api.SplitTreeNode, width, height int, weights map[string]float64) {
+	links := n.GetLinks()
+	linkWeights := make([]float64, len(links))
+	for i, l := range links {
+		linkWeights[i] = 1
+		if w, ok := weights[paneSetKey(splitLinkIDs(l))]; ok {
+			linkWeights[i] = w
+		}
+	}
+	total := height
+	if n.GetVertical() {
+		total = width
+	}
+	for i, size := range layout.Distribute(total, linkWeights) {
+		w, h := width, size
+		if n.GetVertical() {
+			w, h = size, height
+		}
+		if sess := links[i].GetSession(); sess != nil {
+			sess.GridSize = &api.Size{Width: proto.Int32(int32(w)), Height: proto.Int32(int32(h))}
+		} else {
+			resizeSplitTree(links[i].GetNode(), w, h, weights)
+		}
+	}
+}
+
+// splitTreeSize returns the grid size of n: the sum of its links along the
+// split, and the size of the first across it.
+func splitTreeSize(n *api.SplitTreeNode) (width, height int) {
+	for i, l := range n.GetLinks() {
+		var w, h int
+		if sess := l.GetSession(); sess != nil {
+			w, h = int(sess.GetGridSize().GetWidth()), int(sess.GetGridSize().GetHeight())
+		} else {
+			w, h = splitTreeSize(l.GetNode())
+		}
+		switch {
+		case n.GetVertical():
+			width += w
+			if i == 0 {
+				height = h
+			}
+		default:
+			height += h
+			if i == 0 {
+				width = w
+			}
+		}
+	}
+	return width, height
+}
+
+func splitLinkIDs(l *api.SplitTreeNode_SplitTreeLink) []string {
+	if sess := l.GetSession(); sess != nil {
+		return []string{sess.GetUniqueIdentifier()}
+	}
+	var ids []string
+	for _, child := range l.GetNode().GetLinks() {
+		ids = append(ids, splitLinkIDs(child)...)
+	}
+	return ids
+}
+
+// paneSetKey identifies a set of panes by their ids.
+func paneSetKey(ids []string) string {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return strings.Join(ids, " ")
+}
+
+type iterm2Pane struct {
+	s iterm2.Session
+}
+
+func (p *iterm2Pane) ID() string {
+	return p.s.GetSessionID()
+}
+
+func (p *iterm2Pane) Split(ctx context.Context, vertical bool) (Pane, error) {
+	s, err := p.s.SplitPane(ctx, iterm2.SplitPaneOptions{
+		Vertical:                vertical,
+		CustomProfileProperties: sessionProps,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &iterm2Pane{s: s}, nil
+}
+
+func (p *iterm2Pane) SetName(ctx context.Context, name string) error {
+	return p.s.SetName(ctx, name)
+}
+
+// Name returns the session.name variable, which SetName sets.
+func (p *iterm2Pane) Name(ctx context.Context) (string, error) {
+	return p.stringVariable(ctx, "name")
+}
+
+func (p *iterm2Pane) Restart(ctx context.Context) error {
+	return p.s.Restart(ctx, false)
+}
+
+func (p *iterm2Pane) Job(ctx context.Context) (string, error) {
+	return p.stringVariable(ctx, "jobName")
+}
+
+// stringVariable returns the value of a session variable that holds a string.
+func (p *iterm2Pane) stringVariable(ctx context.Context, name string) (string, error) {
+	value, err := p.s.GetVariable(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	// Variables are JSON values.
+	var str string
+	if err := json.Unmarshal([]byte(value), &str); err != nil {
+		return "", fmt.Errorf("session variable %s %s: %w", name, value, err)
+	}
+	return str, nil
+}
+
+func (p *iterm2Pane) SendText(ctx context.Context, text string) error {
+	return p.s.SendText(ctx, text)
+}
+
+// Alive checks the session still exists by reading a variable from it.
+// iTerm2 returns an error for unknown sessions.
+func (p *iterm2Pane) Alive(ctx context.Context) error {
+	if _, err := p.s.GetVariable(ctx, "jobName"); err != nil {
+		return fmt.Errorf("session %s is gone: %w", p.s.GetSessionID(), err)
+	}
+	return nil
+}
+
+func (p *iterm2Pane) Close(ctx context.Context) error {
+	return p.s.Close(ctx, true)
+}
+
+// ScreenOffset returns the number of the line the cursor is on.
+func (p *iterm2Pane) ScreenOffset(ctx context.Context) (int64, error) {
+	buf, err := p.s.GetBuffer(ctx, 1)
+	if err != nil {
+		return 0, err
+	}
+	return buf.CursorLine, nil
+}
+
+// ReadScreen returns the lines from the line numbered offset on.
+func (p *iterm2Pane) ReadScreen(ctx context.Context, offset int64) (string, error) {
+	buf, err := p.s.GetBuffer(ctx, screenLines)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i := min(max(0, offset-buf.FirstLine), int64(len(buf.Lines))); i < int64(len(buf.Lines)); i++ {
+		b.WriteString(buf.Lines[i])
+		if !buf.Continued[i] && i < int64(len(buf.Lines))-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// CanRunCommands checks for shell integration, which reports when commands
+// start and end.
+func (p *iterm2Pane) CanRunCommands(ctx context.Context) (bool, error) {
+	return p.s.HasShellIntegration(ctx)
+}
+
+func (p *iterm2Pane) RunCommand(ctx context.Context, command string) (CommandResult, error) {
+	result, err := p.s.RunCommand(ctx, command)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{ExitStatus: result.ExitStatus, End: result.End}, nil
+}
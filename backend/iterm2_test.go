@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pglass/iterm-tool/iterm2"
+	"github.com/pglass/iterm-tool/iterm2/iterm2test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterm2ReadScreen(t *testing.T) {
+	long := strings.Repeat("x", 100)
+
+	tests := []struct {
+		name string
+		// before is printed before taking the offset, and after once it is
+		// taken.
+		before, after string
+		expScreen     string
+	}{
+		{
+			name:      "output",
+			before:    "$ make serve\n",
+			after:     "Listening on :8080\n",
+			expScreen: "Listening on :8080",
+		},
+		{
+			name:      "no output yet",
+			before:    "$ make serve\n",
+			expScreen: "",
+		},
+		{
+			name:      "on the cursor's line",
+			before:    "$ ",
+			after:     "make serve\nListening on :8080\n",
+			expScreen: "$ make serve\nListening on :8080",
+		},
+		{
+			name:      "wrapped output",
+			after:     long + "\nok\n",
+			expScreen: long + "\nok",
+		},
+		{
+			name:      "wrapped before",
+			before:    "$ " + long + "\n",
+			after:     "ok\n",
+			expScreen: "ok",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := iterm2test.NewServer()
+			t.Cleanup(func() { srv.Close() })
+			app, err := iterm2.NewAppWithOptions("test", srv.ClientOptions())
+			require.NoError(t, err)
+			b := &iterm2Backend{app: app}
+			t.Cleanup(func() { b.Close() })
+			ctx := context.Background()
+
+			w, err := b.CreateWindow(ctx, "test")
+			require.NoError(t, err)
+			tabs, err := w.ListTabs(ctx)
+			require.NoError(t, err)
+			panes, err := tabs[0].ListPanes(ctx)
+			require.NoError(t, err)
+			reader := panes[0].(ScreenReader)
+
+			require.NoError(t, srv.Print(panes[0].ID(), tt.before))
+			offset, err := reader.ScreenOffset(ctx)
+			require.NoError(t, err)
+			require.NoError(t, srv.Print(panes[0].ID(), tt.after))
+
+			screen, err := reader.ReadScreen(ctx, offset)
+			require.NoError(t, err)
+			require.Equal(t, tt.expScreen, screen)
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/creack/pty"
+)
+
+// ptyRows and ptyCols are the size of the pseudo-terminals, which decides
+// where shells wrap long lines.
+const (
+	ptyRows = 50
+	ptyCols = 200
+)
+
+// ptyBackend runs each pane as a shell attached to a pseudo-terminal owned by
+// this process. There is no terminal emulator, so nothing is displayed;
+// instead, everything a pane prints goes to <LogDir>/<pane name>.log.
+//
+// Windows, tabs and splits only exist in memory and vanish when the tool
+// exits, along with the shells.
+type ptyBackend struct {
+	logDir string
+	shell  string
+
+	mu      sync.Mutex
+	windows map[string]*ptyWindow
+	nextID  int
+}
+
+func newPty(opts Options) (*ptyBackend, error) {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "bash"
+	}
+	return &ptyBackend{
+		logDir:  opts.LogDir,
+		shell:   shell,
+		windows: map[string]*ptyWindow{},
+	}, nil
+}
+
+func (b *ptyBackend) newID(prefix string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return fmt.Sprintf("%s-%d", prefix, b.nextID)
+}
+
+func (b *ptyBackend) Close() error {
+	b.mu.Lock()
+	windows := b.windows
+	b.windows = map[string]*ptyWindow{}
+	b.mu.Unlock()
+
+	var errs []error
+	for _, w := range windows {
+		errs = append(errs, w.close())
+	}
+	return errors.Join(errs...)
+}
+
+func (b *ptyBackend) CreateWindow(ctx context.Context, title string) (Window, error) {
+	logDir := b.logDir
+	if logDir == "" {
+		logDir = filepath.Join(os.TempDir(), "iterm-tool", title)
+	}
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	slog.Info("writing session logs", "dir", logDir)
+
+	w := &ptyWindow{b: b, id: b.newID("window"), logDir: logDir}
+	if _, err := w.CreateTab(ctx); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.windows[w.id] = w
+	b.mu.Unlock()
+	return w, nil
+}
+
+func (b *ptyBackend) CloseWindow(ctx context.Context, id string) error {
+	b.mu.Lock()
+	w, ok := b.windows[id]
+	delete(b.windows, id)
+	b.mu.Unlock()
+	if !ok {
+		// Windows from a previous run died with that run.
+		return nil
+	}
+	return w.close()
+}
+
+// FindWindow only finds windows of this run. Windows from a previous run
+// died with that run.
+func (b *ptyBackend) FindWindow(ctx context.Context, id string) (Window, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if w, ok := b.windows[id]; ok {
+		return w, nil
+	}
+	return nil, nil
+}
+
+type ptyWindow struct {
+	b      *ptyBackend
+	id     string
+	logDir string
+
+	mu   sync.Mutex
+	tabs []*ptyTab
+}
+
+func (w *ptyWindow) ID() string {
+	return w.id
+}
+
+func (w *ptyWindow) ListTabs(ctx context.Context) ([]Tab, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var result []Tab
+	for _, t := range w.tabs {
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func (w *ptyWindow) CreateTab(ctx context.Context) (Tab, error) {
+	t := &ptyTab{w: w, id: w.b.newID("tab")}
+	if _, err := t.newPane(); err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	w.tabs = append(w.tabs, t)
+	w.mu.Unlock()
+	return t, nil
+}
+
+func (w *ptyWindow) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for _, t := range w.tabs {
+		for _, p := range t.panes {
+			errs = append(errs, p.close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type ptyTab struct {
+	w  *ptyWindow
+	id string
+
+	mu    sync.Mutex
+	panes []*ptyPane
+}
+
+func (t *ptyTab) ID() string {
+	return t.id
+}
+
+func (t *ptyTab) SetTitle(ctx context.Context, title string) error {
+	return nil
+}
+
+func (t *ptyTab) ListPanes(ctx context.Context) ([]Pane, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var result []Pane
+	for _, p := range t.panes {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// newPane starts a shell and adds it to the tab.
+func (t *ptyTab) newPane() (*ptyPane, error) {
+	id := t.w.b.newID("pane")
+	logPath := filepath.Join(t.w.logDir, id+".log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("create session log: %w", err)
+	}
+
+	cmd := exec.Command(t.w.b.shell)
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: ptyRows, Cols: ptyCols})
+	if err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("start %s: %w", t.w.b.shell, err)
+	}
+
+	p := &ptyPane{
+		t:       t,
+		id:      id,
+		cmd:     cmd,
+		ptmx:    ptmx,
+		logFile: logFile,
+		logPath: logPath,
+		copied:  make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		// Returns once the shell exits or the pty is closed.
+		io.Copy(logFile, ptmx)
+		close(p.copied)
+	}()
+	go func() {
+		p.waitErr = cmd.Wait()
+		close(p.exited)
+	}()
+
+	t.mu.Lock()
+	t.panes = append(t.panes, p)
+	t.mu.Unlock()
+	return p, nil
+}
+
+type ptyPane struct {
+	t    *ptyTab
+	id   string
+	cmd  *exec.Cmd
+	ptmx *os.File
+
+	mu      sync.Mutex
+	name    string
+	logFile *os.File
+	logPath string
+
+	// copied is closed once the pane's output stops being copied to logFile.
+	copied  chan struct{}
+	exited  chan struct{}
+	waitErr error
+}
+
+func (p *ptyPane) ID() string {
+	return p.id
+}
+
+func (p *ptyPane) Split(ctx context.Context, vertical bool) (Pane, error) {
+	// There is no screen to split. Every pane is simply another shell.
+	return p.t.newPane()
+}
+
+// SetName renames the pane's log file, so that logs are named after the session.
+func (p *ptyPane) SetName(ctx context.Context, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Grouped session names contain dots, which are fine in file names. Slashes are not.
+	newPath := filepath.Join(p.t.w.logDir, strings.ReplaceAll(name, "/", "_")+".log")
+	if err := os.Rename(p.logPath, newPath); err != nil {
+		return fmt.Errorf("rename session log: %w", err)
+	}
+	p.logPath = newPath
+	p.name = name
+	return nil
+}
+
+func (p *ptyPane) Name(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.name, nil
+}
+
+func (p *ptyPane) SendText(ctx context.Context, text string) error {
+	if err := p.Alive(ctx); err != nil {
+		return err
+	}
+	_, err := io.WriteString(p.ptmx, text)
+	return err
+}
+
+// ScreenOffset returns the size of the pane's log, which holds everything
+// the pane printed.
+func (p *ptyPane) ScreenOffset(ctx context.Context) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := p.logFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// ReadScreen returns the end of the pane's log, past offset bytes, as the
+// pane shows it: see renderLine.
+func (p *ptyPane) ReadScreen(ctx context.Context, offset int64) (string, error) {
+	p.mu.Lock()
+	data, err := os.ReadFile(p.logPath)
+	p.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	data = data[min(max(0, offset), int64(len(data))):]
+	lines := strings.Split(string(data), "\n")
+	lines = lines[max(0, len(lines)-screenLines):]
+	for i, line := range lines {
+		lines[i] = renderLine(line, ptyCols)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// renderLine returns what a terminal width columns wide shows for a line of
+// output. Carriage returns and backspaces move back over the text, which is
+// how shells redraw a line they wrapped, and escape sequences are left out.
+func renderLine(s string, width int) string {
+	var line []rune
+	col := 0
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\r':
+			// Back to the start of the row the cursor is on. Right after the
+			// last column, the cursor is still on that column's row.
+			col = max(0, col-1) / width * width
+		case '\b':
+			col = max(0, col-1)
+		case '\x1b':
+			i = skipEscape(runes, i)
+		default:
+			if col < len(line) {
+				line[col] = r
+			} else {
+				line = append(line, r)
+			}
+			col++
+		}
+	}
+	return string(line)
+}
+
+// skipEscape returns the index of the last rune of the escape sequence that
+// starts at runes[i]: a control sequence, like "\x1b[?2004h", an operating
+// system command, like a title ending in BEL, or else a single character.
+func skipEscape(runes []rune, i int) int {
+	switch {
+	case i+1 < len(runes) && runes[i+1] == '[':
+		for i += 2; i < len(runes); i++ {
+			if runes[i] >= 0x40 && runes[i] <= 0x7e {
+				return i
+			}
+		}
+	case i+1 < len(runes) && runes[i+1] == ']':
+		for i += 2; i < len(runes); i++ {
+			if runes[i] == '\a' {
+				return i
+			}
+			if runes[i] == '\x1b' && i+1 < len(runes) && runes[i+1] == '\\' {
+				return i + 1
+			}
+		}
+	default:
+		return min(i+1, len(runes)-1)
+	}
+	return len(runes) - 1
+}
+
+func (p *ptyPane) Alive(ctx context.Context) error {
+	select {
+	case <-p.exited:
+		return fmt.Errorf("shell in pane %s exited: %v", p.id, p.waitErr)
+	default:
+		return nil
+	}
+}
+
+// Close stops the pane's shell and removes the pane from its tab.
+func (p *ptyPane) Close(ctx context.Context) error {
+	p.t.mu.Lock()
+	p.t.panes = slices.DeleteFunc(p.t.panes, func(other *ptyPane) bool { return other == p })
+	p.t.mu.Unlock()
+	return p.close()
+}
+
+func (p *ptyPane) close() error {
+	// Closing the pty hangs up the shell and whatever it is running.
+	err := p.ptmx.Close()
+	select {
+	case <-p.exited:
+	default:
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+	// Let the copy finish writing before closing the log under it.
+	<-p.copied
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Join(err, p.logFile.Close())
+}
@@ -0,0 +1,45 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+
+		exp string
+	}{
+		{name: "plain", in: "hello", exp: "hello"},
+		{name: "carriage return", in: "hello\rj", exp: "jello"},
+		{name: "backspace", in: "hellp\bo", exp: "hello"},
+		{name: "control sequence", in: "\x1b[?2004h$ ls\x1b[0m", exp: "$ ls"},
+		{name: "title", in: "\x1b]0;title\a$ ls", exp: "$ ls"},
+		{name: "unterminated", in: "$ ls\x1b[", exp: "$ ls"},
+		{
+			// Shells wrap a long line by writing past the last column, then
+			// going back to the start of the new row to write it again.
+			name: "wrapped",
+			in:   "$ echo 0123\r3456",
+			exp:  "$ echo 0123456",
+		},
+		{
+			name: "carriage return on a wrapped row",
+			in:   "$ echo 0123456789abcd\rXY",
+			exp:  "$ echo 0123456789abcXY",
+		},
+		{
+			name: "carriage return after the last column",
+			in:   "$ echo 012\rX",
+			exp:  "X echo 012",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.exp, renderLine(tt.in, 10))
+		})
+	}
+}
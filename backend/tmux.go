@@ -0,0 +1,288 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pglass/iterm-tool/layout"
+)
+
+// tmuxBackend maps windows to tmux sessions and tabs to tmux windows.
+//
+// Each config gets its own detached tmux session named after the window
+// title, so it can be attached with `tmux attach -t <id>` and killed without
+// touching any other tmux session.
+type tmuxBackend struct {
+	bin string
+}
+
+func newTmux(opts Options) (*tmuxBackend, error) {
+	bin, err := exec.LookPath("tmux")
+	if err != nil {
+		return nil, fmt.Errorf("tmux backend: %w", err)
+	}
+	return &tmuxBackend{bin: bin}, nil
+}
+
+// run runs a tmux command and returns its trimmed stdout.
+func (b *tmuxBackend) run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tmux %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// exactSession returns a target that only matches the session with exactly this name.
+func exactSession(name string) string {
+	return "=" + name
+}
+
+// sessionName returns the name tmux gives a session created with this name:
+// tmux replaces the dots and colons, which separate the parts of a target.
+func sessionName(name string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(name)
+}
+
+func (b *tmuxBackend) Close() error {
+	return nil
+}
+
+func (b *tmuxBackend) CreateWindow(ctx context.Context, title string) (Window, error) {
+	name := sessionName(title)
+	if _, err := b.run(ctx, "new-session", "-d", "-s", name, "-n", title); err != nil {
+		return nil, err
+	}
+	return &tmuxWindow{b: b, name: name}, nil
+}
+
+func (b *tmuxBackend) CloseWindow(ctx context.Context, id string) error {
+	if _, err := b.run(ctx, "has-session", "-t", exactSession(id)); err != nil {
+		// No such session.
+		return nil
+	}
+	_, err := b.run(ctx, "kill-session", "-t", exactSession(id))
+	return err
+}
+
+func (b *tmuxBackend) FindWindow(ctx context.Context, id string) (Window, error) {
+	if _, err := b.run(ctx, "has-session", "-t", exactSession(id)); err != nil {
+		// No such session.
+		return nil, nil
+	}
+	return &tmuxWindow{b: b, name: id}, nil
+}
+
+type tmuxWindow struct {
+	b    *tmuxBackend
+	name string
+}
+
+func (w *tmuxWindow) ID() string {
+	return w.name
+}
+
+func (w *tmuxWindow) ListTabs(ctx context.Context) ([]Tab, error) {
+	out, err := w.b.run(ctx, "list-windows", "-t", exactSession(w.name), "-F", "#{window_id}")
+	if err != nil {
+		return nil, err
+	}
+	var result []Tab
+	for _, id := range strings.Fields(out) {
+		result = append(result, &tmuxTab{b: w.b, id: id})
+	}
+	return result, nil
+}
+
+func (w *tmuxWindow) CreateTab(ctx context.Context) (Tab, error) {
+	id, err := w.b.run(ctx, "new-window", "-d", "-t", exactSession(w.name)+":", "-P", "-F", "#{window_id}")
+	if err != nil {
+		return nil, err
+	}
+	return &tmuxTab{b: w.b, id: id}, nil
+}
+
+type tmuxTab struct {
+	b  *tmuxBackend
+	id string
+}
+
+func (t *tmuxTab) ID() string {
+	return t.id
+}
+
+func (t *tmuxTab) SetTitle(ctx context.Context, title string) error {
+	_, err := t.b.run(ctx, "rename-window", "-t", t.id, title)
+	return err
+}
+
+func (t *tmuxTab) ListPanes(ctx context.Context) ([]Pane, error) {
+	out, err := t.b.run(ctx, "list-panes", "-t", t.id, "-F", "#{pane_id}")
+	if err != nil {
+		return nil, err
+	}
+	var result []Pane
+	for _, id := range strings.Fields(out) {
+		result = append(result, &tmuxPane{b: t.b, id: id})
+	}
+	return result, nil
+}
+
+// Resize sizes the panes of the window top-down: each entry but the last of
+// a row or column is resized, which takes the cells from its next sibling.
+func (t *tmuxTab) Resize(ctx context.Context, root *layout.Node, panes map[string]Pane) error {
+	out, err := t.b.run(ctx, "display-message", "-p", "-t", t.id, "#{window_width} #{window_height}")
+	if err != nil {
+		return err
+	}
+	var width, height int
+	if _, err := fmt.Sscan(out, &width, &height); err != nil {
+		return fmt.Errorf("tmux window size %q: %w", out, err)
+	}
+
+	var resize func(n *layout.Node, width, height int) error
+	resize = func(n *layout.Node, width, height int) error {
+		if len(n.Children) == 0 {
+			return nil
+		}
+		var weights []float64
+		for _, child := range n.Children {
+			weights = append(weights, child.Weight())
+		}
+		// Panes are one cell apart, for the divider.
+		total, flag := height, "-y"
+		if n.Columns {
+			total, flag = width, "-x"
+		}
+		sizes := layout.Distribute(total-(len(n.Children)-1), weights)
+		for i, child := range n.Children {
+			if i < len(n.Children)-1 {
+				pane, ok := panes[child.Sessions()[0]]
+				if !ok {
+					return fmt.Errorf("no pane for session %q", child.Sessions()[0])
+				}
+				if _, err := t.b.run(ctx, "resize-pane", "-t", pane.ID(), flag, strconv.Itoa(sizes[i])); err != nil {
+					return err
+				}
+			}
+			w, h := width, sizes[i]
+			if n.Columns {
+				w, h = sizes[i], height
+			}
+			if err := resize(child, w, h); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return resize(root.Flatten(), width, height)
+}
+
+type tmuxPane struct {
+	b  *tmuxBackend
+	id string
+}
+
+func (p *tmuxPane) ID() string {
+	return p.id
+}
+
+func (p *tmuxPane) Split(ctx context.Context, vertical bool) (Pane, error) {
+	// tmux names splits after the orientation of the panes rather than the
+	// divider: -h puts the new pane to the right.
+	direction := "-v"
+	if vertical {
+		direction = "-h"
+	}
+	id, err := p.b.run(ctx, "split-window", direction, "-d", "-t", p.id, "-P", "-F", "#{pane_id}")
+	if err != nil {
+		return nil, err
+	}
+	return &tmuxPane{b: p.b, id: id}, nil
+}
+
+func (p *tmuxPane) SetName(ctx context.Context, name string) error {
+	_, err := p.b.run(ctx, "select-pane", "-t", p.id, "-T", name)
+	return err
+}
+
+// Name returns the pane title, which SetName sets.
+func (p *tmuxPane) Name(ctx context.Context) (string, error) {
+	return p.b.run(ctx, "display-message", "-p", "-t", p.id, "#{pane_title}")
+}
+
+func (p *tmuxPane) Restart(ctx context.Context) error {
+	// -k kills the command first, if it is still running.
+	_, err := p.b.run(ctx, "respawn-pane", "-k", "-t", p.id)
+	return err
+}
+
+func (p *tmuxPane) Job(ctx context.Context) (string, error) {
+	return p.b.run(ctx, "display-message", "-p", "-t", p.id, "#{pane_current_command}")
+}
+
+func (p *tmuxPane) SendText(ctx context.Context, text string) error {
+	// -l sends the text literally instead of looking up key names.
+	_, err := p.b.run(ctx, "send-keys", "-t", p.id, "-l", text)
+	return err
+}
+
+// ScreenOffset returns the line of the cursor, counting from the start of
+// the pane's history.
+func (p *tmuxPane) ScreenOffset(ctx context.Context) (int64, error) {
+	out, err := p.b.run(ctx, "display-message", "-p", "-t", p.id, "#{history_size} #{cursor_y}")
+	if err != nil {
+		return 0, err
+	}
+	var history, cursor int64
+	if _, err := fmt.Sscan(out, &history, &cursor); err != nil {
+		return 0, fmt.Errorf("tmux cursor %q: %w", out, err)
+	}
+	return history + cursor, nil
+}
+
+// ReadScreen captures the pane from the line at offset on. Once the history
+// is full, tmux drops its first lines, and the offset points at a later line
+// than it did.
+func (p *tmuxPane) ReadScreen(ctx context.Context, offset int64) (string, error) {
+	out, err := p.b.run(ctx, "display-message", "-p", "-t", p.id, "#{history_size}")
+	if err != nil {
+		return "", err
+	}
+	history, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("tmux history size %q: %w", out, err)
+	}
+	// -S is a line of the visible screen, or of the history if negative.
+	// -J joins wrapped lines.
+	start := max(offset-history, -history)
+	screen, err := p.b.run(ctx, "capture-pane", "-p", "-J", "-S", strconv.FormatInt(start, 10), "-t", p.id)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(screen, "\n")
+	return strings.Join(lines[max(0, len(lines)-screenLines):], "\n"), nil
+}
+
+func (p *tmuxPane) Alive(ctx context.Context) error {
+	out, err := p.b.run(ctx, "display-message", "-p", "-t", p.id, "#{pane_dead}")
+	if err != nil {
+		return fmt.Errorf("pane %s is gone: %w", p.id, err)
+	}
+	if out == "1" {
+		return fmt.Errorf("pane %s is dead", p.id)
+	}
+	return nil
+}
+
+func (p *tmuxPane) Close(ctx context.Context) error {
+	_, err := p.b.run(ctx, "kill-pane", "-t", p.id)
+	return err
+}
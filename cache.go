@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Cache struct {
@@ -13,7 +14,34 @@ type Cache struct {
 type cacheData map[string]CacheEntry
 
 type CacheEntry struct {
-	WindowID string
+	// WindowIDs are the windows created for a config, the main window first.
+	WindowIDs []string `json:",omitempty"`
+	// WindowID is the main window, in entries written before configs could
+	// have more than one window.
+	WindowID string `json:",omitempty"`
+	// Sessions are the sessions started for the config, by name.
+	Sessions map[string]CachedSession `json:",omitempty"`
+}
+
+// CachedSession records where a session was started, and what it ran.
+type CachedSession struct {
+	PaneID string
+	// Window and Tab name the place of the session in the config.
+	Window string `json:",omitempty"`
+	Tab    string `json:",omitempty"`
+	// Hash is the session's config.Session.Hash.
+	Hash string
+	// ReadyAfter is how long the session took to be ready, from when it
+	// started, the last time it ran successfully.
+	ReadyAfter time.Duration `json:",omitempty"`
+}
+
+// Windows returns the ids of all the windows in the entry.
+func (e CacheEntry) Windows() []string {
+	if e.WindowID != "" {
+		return append([]string{e.WindowID}, e.WindowIDs...)
+	}
+	return e.WindowIDs
 }
 
 func NewCache() (*Cache, error) {
@@ -54,6 +82,16 @@ func (c *Cache) Put(key string, entry CacheEntry) error {
 	return c.write(data)
 }
 
+// Delete forgets the entry for key.
+func (c *Cache) Delete(key string) error {
+	data, err := c.read()
+	if err != nil {
+		return err
+	}
+	delete(data, key)
+	return c.write(data)
+}
+
 func (c *Cache) read() (cacheData, error) {
 	// read the file - see if it's valid.
 	var data cacheData
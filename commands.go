@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pglass/iterm-tool/backend"
+	"github.com/pglass/iterm-tool/config"
+	"github.com/pglass/iterm-tool/graph"
+	"github.com/pglass/iterm-tool/plan"
+	"github.com/pglass/iterm-tool/scheduler"
+	"github.com/urfave/cli/v2"
+)
+
+var jsonFlag = &cli.BoolFlag{
+	Name:  "json",
+	Usage: "print the result as JSON",
+}
+
+var dryRunFlag = &cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "print what running the config from scratch does, without touching the terminal",
+}
+
+var commands = []*cli.Command{
+	{
+		Name:  "up",
+		Usage: "start the sessions, keeping the ones that are already running",
+		Description: "Finds the windows of the last run and updates them to match the config. Sessions that\n" +
+			"did not change are left running, changed sessions are restarted in their pane, new\n" +
+			"sessions get new panes, and the panes of removed sessions are closed.",
+		Flags: []cli.Flag{
+			jsonFlag,
+			dryRunFlag,
+			&cli.BoolFlag{
+				Name:  "recreate",
+				Usage: "close the windows of the last run and start every session from scratch",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return upCommand(c, c.Bool("recreate"))
+		},
+	},
+	{
+		Name:   "down",
+		Usage:  "close the windows of the last run",
+		Flags:  []cli.Flag{jsonFlag},
+		Action: downCommand,
+	},
+	{
+		Name:  "restart",
+		Usage: "restart sessions in their panes",
+		Description: "Starts the shell of each session over in its pane, and runs its script and inject\n" +
+			"again. Sessions that the given sessions depend on are left as they are.",
+		ArgsUsage: "<session>...",
+		Flags: []cli.Flag{
+			jsonFlag,
+			&cli.BoolFlag{
+				Name:  "dependents",
+				Usage: "also restart the sessions that depend on the given sessions",
+			},
+		},
+		Action: restartCommand,
+	},
+	{
+		Name:   "status",
+		Usage:  "show the state of each session",
+		Flags:  []cli.Flag{jsonFlag},
+		Action: statusCommand,
+	},
+	{
+		Name:   "validate",
+		Usage:  "report every problem in the config, as file:line:column: message",
+		Flags:  []cli.Flag{jsonFlag},
+		Action: validateCommand,
+	},
+	{
+		Name:  "graph",
+		Usage: "print the dependencies between sessions, as Graphviz DOT or Mermaid",
+		Description: "Each session is labeled with what it runs, its group and its readiness checks. Once the\n" +
+			"sessions have run, the chain of dependencies that took longest to be ready is highlighted.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "dot",
+				Usage: "`format` of the graph: dot or mermaid",
+			},
+		},
+		Action: graphCommand,
+	},
+	{
+		Name:  "schema",
+		Usage: "print a JSON Schema for config files",
+		Action: func(c *cli.Context) error {
+			return printSchema(c.App.Writer)
+		},
+	},
+}
+
+// configFiles returns the config files given with -c.
+func configFiles(c *cli.Context) ([]string, error) {
+	files := c.StringSlice("config")
+	if len(files) == 0 {
+		return nil, cli.Exit("config file is required (-c)", 1)
+	}
+	return files, nil
+}
+
+// loadConfig loads the config files given with -c.
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	files, err := configFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetLogLoggerLevel(slog.LevelDebug)
+	slog.Info("load config", "files", files)
+	cfg, err := config.LoadConfig(files...)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	return cfg, nil
+}
+
+// newBackend connects to a backend. Tests replace it, to keep using the
+// same pty backend across commands.
+var newBackend = backend.New
+
+// openStack loads the config and connects to its backend.
+func openStack(c *cli.Context) (*stack, error) {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := NewCache()
+	if err != nil {
+		return nil, fmt.Errorf("init cache: %w", err)
+	}
+
+	backendName := backend.Default
+	if cfg.Backend != "" {
+		backendName = cfg.Backend
+	}
+	if name := c.String("backend"); name != "" {
+		backendName = name
+	}
+	slog.Info("creating stack", "id", cfg.ID, "backend", backendName)
+	term, err := newBackend(backendName, backend.Options{
+		AppName: cfg.ID,
+		LogDir:  c.String("log-dir"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newStack(term, cfg, cache)
+	if err != nil {
+		term.Close()
+		return nil, fmt.Errorf("read cache: %w", err)
+	}
+	return s, nil
+}
+
+// upCommand starts the sessions: from scratch with recreate, or else
+// reconciling the windows of the last run.
+func upCommand(c *cli.Context, recreate bool) error {
+	if c.Bool("dry-run") {
+		return dryRun(c)
+	}
+	s, err := openStack(c)
+	if err != nil {
+		return err
+	}
+	defer s.term.Close()
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt)
+	defer stop()
+	setupCtx, cancelSetup := context.WithTimeout(ctx, setupTimeout)
+	defer cancelSetup()
+
+	// Either start over, or keep what is still running from the last run.
+	unchanged, interrupt := map[string]bool{}, map[string]bool{}
+	if recreate {
+		if err := s.build(setupCtx); err != nil {
+			return err
+		}
+	} else if unchanged, interrupt, err = s.reconcile(setupCtx); err != nil {
+		return fmt.Errorf("reconcile windows: %w", err)
+	}
+	if err := s.save(); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+
+	results, err := s.start(ctx, slices.Sorted(maps.Keys(s.cfg.Sessions)), unchanged, interrupt, c.Int("max-parallel"))
+	if err != nil {
+		return fmt.Errorf("run sessions: %w", err)
+	}
+	if err := s.saveTimings(results, unchanged); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+	return report(c, results)
+}
+
+// dryRun prints the plan of the config instead of running it.
+func dryRun(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	p := plan.New(cfg)
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, p)
+	}
+	p.Print(c.App.Writer)
+	return nil
+}
+
+// restartCommand starts the sessions named on the command line over in their
+// panes: it restarts the pane's shell where the backend can, or else
+// interrupts what the session was running. With --dependents, the sessions
+// that depend on them are restarted too, once they are ready again.
+func restartCommand(c *cli.Context) error {
+	var names []string
+	for _, name := range c.Args().Slice() {
+		names = append(names, strings.TrimPrefix(name, "sessions."))
+	}
+	if len(names) == 0 {
+		return cli.Exit("restart needs the names of the sessions to restart", 1)
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	s, err := openStack(c)
+	if err != nil {
+		return err
+	}
+	defer s.term.Close()
+	for _, name := range names {
+		if s.cfg.Sessions[name] == nil {
+			return cli.Exit(fmt.Sprintf("no such session %q", name), 1)
+		}
+	}
+	if c.Bool("dependents") {
+		names = s.cfg.Dependents(names)
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt)
+	defer stop()
+	setupCtx, cancelSetup := context.WithTimeout(ctx, setupTimeout)
+	defer cancelSetup()
+
+	matched, err := s.match(setupCtx)
+	if err != nil {
+		return fmt.Errorf("find sessions: %w", err)
+	}
+	// Find all the panes before restarting any.
+	for _, name := range names {
+		f, ok := matched[name]
+		if !ok {
+			return cli.Exit(fmt.Sprintf("session %q has no pane, start it with up", name), 1)
+		}
+		// Panes whose shell exited can only be restarted.
+		if _, ok := f.pane.(backend.Restarter); !ok && f.pane.Alive(setupCtx) != nil {
+			return cli.Exit(fmt.Sprintf("session %q is not running, start it with up", name), 1)
+		}
+		s.panes[name] = f.pane
+	}
+	interrupt, err := s.restart(setupCtx, names)
+	if err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+
+	results, err := s.start(ctx, names, nil, interrupt, c.Int("max-parallel"))
+	if err != nil {
+		return fmt.Errorf("run sessions: %w", err)
+	}
+	if err := s.saveTimings(results, nil); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+	return report(c, results)
+}
+
+// sessionResult is how a session did in a run, for --json.
+type sessionResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// report prints the results of a run, and returns an error to exit non-zero
+// with if any session did not succeed.
+func report(c *cli.Context, results []scheduler.Result) error {
+	ok := true
+	if c.Bool("json") {
+		out := []sessionResult{}
+		for _, r := range results {
+			result := sessionResult{Name: r.Name, Status: r.Status.String()}
+			if r.Err != nil {
+				result.Error = r.Err.Error()
+			}
+			out = append(out, result)
+			ok = ok && r.Status == scheduler.StatusSucceeded
+		}
+		if err := printJSON(c.App.Writer, out); err != nil {
+			return err
+		}
+	} else {
+		ok = printFailureSummary(c.App.ErrWriter, results)
+	}
+	if !ok {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+// downCommand closes the windows of the last run, and forgets them.
+func downCommand(c *cli.Context) error {
+	s, err := openStack(c)
+	if err != nil {
+		return err
+	}
+	defer s.term.Close()
+
+	ctx, cancel := context.WithTimeout(c.Context, setupTimeout)
+	defer cancel()
+	closed := []string{}
+	for _, id := range s.cached.Windows() {
+		slog.Info("closing window", "id", id)
+		if err := s.term.CloseWindow(ctx, id); err != nil {
+			return fmt.Errorf("close window: %w", err)
+		}
+		closed = append(closed, id)
+	}
+	if err := s.cache.Delete(s.cfg.ID); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, struct {
+			ClosedWindows []string `json:"closed_windows"`
+		}{closed})
+	}
+	if len(closed) == 0 {
+		fmt.Fprintln(c.App.Writer, "no windows to close")
+	}
+	for _, id := range closed {
+		fmt.Fprintf(c.App.Writer, "closed window %s\n", id)
+	}
+	return nil
+}
+
+// The states of a session in status.
+const (
+	// stateRunning sessions have a pane, and have not changed since they
+	// were started.
+	stateRunning = "running"
+	// stateChanged sessions have a pane, but changed or moved to another
+	// tab since they were started. up restarts or moves them.
+	stateChanged = "changed"
+	// stateExited sessions have a pane whose shell is gone.
+	stateExited = "exited"
+	// stateStopped sessions have no pane. up starts them.
+	stateStopped = "stopped"
+	// stateRemoved sessions have a pane, but are no longer in the config.
+	// up closes them.
+	stateRemoved = "removed"
+)
+
+// sessionStatus is the state of a session, for status.
+type sessionStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	WindowID string `json:"window_id,omitempty"`
+	PaneID   string `json:"pane_id,omitempty"`
+	// Job is the program running in the pane, if the backend can tell.
+	Job string `json:"job,omitempty"`
+}
+
+// statusCommand prints the state of every session of the config, and of the
+// panes of removed sessions.
+func statusCommand(c *cli.Context) error {
+	s, err := openStack(c)
+	if err != nil {
+		return err
+	}
+	defer s.term.Close()
+
+	ctx, cancel := context.WithTimeout(c.Context, setupTimeout)
+	defer cancel()
+	matched, err := s.match(ctx)
+	if err != nil {
+		return fmt.Errorf("find sessions: %w", err)
+	}
+
+	names := slices.Sorted(maps.Keys(s.cfg.Sessions))
+	for name := range matched {
+		if s.cfg.Sessions[name] == nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	statuses := []sessionStatus{}
+	for _, name := range names {
+		status := sessionStatus{Name: name, State: stateStopped}
+		f, ok := matched[name]
+		if !ok {
+			statuses = append(statuses, status)
+			continue
+		}
+		status.WindowID, status.PaneID = f.window.ID(), f.pane.ID()
+
+		sess, rec := s.cfg.Sessions[name], s.cached.Sessions[name]
+		switch {
+		case sess == nil:
+			status.State = stateRemoved
+		case f.pane.Alive(ctx) != nil:
+			status.State = stateExited
+		case rec.Hash != sess.Hash() || sess.Place() != (config.Place{Window: rec.Window, Tab: rec.Tab}):
+			status.State = stateChanged
+		default:
+			status.State = stateRunning
+		}
+		if jr, ok := f.pane.(backend.JobReader); ok && status.State != stateExited {
+			if status.Job, err = jr.Job(ctx); err != nil {
+				return fmt.Errorf("get job of %s: %w", name, err)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, statuses)
+	}
+	w := tabwriter.NewWriter(c.App.Writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tSTATE\tWINDOW\tPANE\tJOB")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status.Name, status.State, status.WindowID, status.PaneID, status.Job)
+	}
+	return w.Flush()
+}
+
+// graphCommand prints the dependency graph of the config, with the timings
+// of the last run.
+func graphCommand(c *cli.Context) error {
+	format := c.String("format")
+	if format != "dot" && format != "mermaid" {
+		return cli.Exit(fmt.Sprintf("unknown format %q (expected dot or mermaid)", format), 1)
+	}
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cache, err := NewCache()
+	if err != nil {
+		return fmt.Errorf("init cache: %w", err)
+	}
+	cached, err := cache.Get(cfg.ID)
+	if err != nil {
+		return fmt.Errorf("read cache: %w", err)
+	}
+
+	timings := map[string]time.Duration{}
+	for name, rec := range cached.Sessions {
+		if rec.ReadyAfter > 0 {
+			timings[name] = rec.ReadyAfter
+		}
+	}
+	g := graph.New(cfg, timings)
+	if format == "mermaid" {
+		return g.WriteMermaid(c.App.Writer)
+	}
+	return g.WriteDOT(c.App.Writer)
+}
+
+func validateCommand(c *cli.Context) error {
+	files, err := configFiles(c)
+	if err != nil {
+		return err
+	}
+	if !validate(c.App.Writer, files, c.Bool("json")) {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pglass/iterm-tool/backend"
+	"github.com/pglass/iterm-tool/config"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// keepOpen keeps a backend open when a command closes it, so that the next
+// command finds its windows, as it would in a terminal.
+type keepOpen struct {
+	backend.Backend
+}
+
+func (keepOpen) Close() error {
+	return nil
+}
+
+// useBackend makes commands use term.
+func useBackend(t *testing.T, term backend.Backend) {
+	old := newBackend
+	newBackend = func(string, backend.Options) (backend.Backend, error) {
+		return keepOpen{term}, nil
+	}
+	t.Cleanup(func() { newBackend = old })
+}
+
+// runApp runs the tool with args, and returns what it printed and its exit
+// code.
+func runApp(t *testing.T, args ...string) (string, int) {
+	var out bytes.Buffer
+	app := newApp()
+	app.Writer = &out
+	app.ErrWriter = io.Discard
+	// Return exit codes instead of exiting.
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	err := app.Run(append([]string{"iterm-tool"}, args...))
+
+	var exitErr cli.ExitCoder
+	switch {
+	case err == nil:
+		return out.String(), 0
+	case errors.As(err, &exitErr):
+		return out.String(), exitErr.ExitCode()
+	default:
+		t.Logf("error: %v", err)
+		return out.String(), 1
+	}
+}
+
+func TestCommands(t *testing.T) {
+	term, cache := newTestBackend(t)
+	useBackend(t, term)
+
+	// exitShell makes the shell of a session of the last run exit.
+	exitShell := func(name string) func(t *testing.T) {
+		return func(t *testing.T) {
+			ctx := context.Background()
+			cfg, err := config.LoadConfig("data/TestCommands.toml")
+			require.NoError(t, err)
+			s, err := newStack(term, cfg, cache)
+			require.NoError(t, err)
+			matched, err := s.match(ctx)
+			require.NoError(t, err)
+			pane := matched[name].pane
+			require.NoError(t, pane.SendText(ctx, "exit\n"))
+			require.Eventually(t, func() bool { return pane.Alive(ctx) != nil }, 5*time.Second, 50*time.Millisecond)
+		}
+	}
+
+	// The steps run in order, against the same backend and cache.
+	steps := []struct {
+		name    string
+		config  string
+		args    []string
+		before  func(t *testing.T)
+		expCode int
+		// expResults are the statuses of the sessions a run printed, by
+		// session name.
+		expResults map[string]string
+		// expStates are the states printed by status, by session name.
+		expStates map[string]string
+		// expClosed are the windows printed by down.
+		expClosed []string
+	}{
+		{
+			name:      "status before up",
+			args:      []string{"status", "--json"},
+			expStates: map[string]string{"a": stateStopped, "b": stateStopped},
+		},
+		{
+			name:       "up",
+			args:       []string{"up", "--json"},
+			expResults: map[string]string{"a": "succeeded", "b": "succeeded"},
+		},
+		{
+			name:      "status after up",
+			args:      []string{"status", "--json"},
+			expStates: map[string]string{"a": stateRunning, "b": stateRunning},
+		},
+		{
+			name:      "status of an edited config",
+			config:    "data/TestCommands_edited.toml",
+			args:      []string{"status", "--json"},
+			expStates: map[string]string{"a": stateChanged, "b": stateRemoved, "c": stateStopped},
+		},
+		{
+			name:      "status after a shell exited",
+			args:      []string{"status", "--json"},
+			before:    exitShell("b"),
+			expStates: map[string]string{"a": stateRunning, "b": stateExited},
+		},
+		{
+			name:    "restart an unknown session",
+			args:    []string{"restart", "--json", "nosuch"},
+			expCode: 1,
+		},
+		{
+			name:    "restart an exited session",
+			args:    []string{"restart", "--json", "b"},
+			expCode: 1,
+		},
+		{
+			name:       "restart",
+			args:       []string{"restart", "--json", "a"},
+			expResults: map[string]string{"a": "succeeded"},
+		},
+		{
+			name:       "up replaces the exited session",
+			args:       []string{"up", "--json"},
+			expResults: map[string]string{"a": "succeeded", "b": "succeeded"},
+		},
+		{
+			name:      "status after up again",
+			args:      []string{"status", "--json"},
+			expStates: map[string]string{"a": stateRunning, "b": stateRunning},
+		},
+		{
+			name:      "down",
+			args:      []string{"down", "--json"},
+			expClosed: []string{"window-1"},
+		},
+		{
+			name:      "down again",
+			args:      []string{"down", "--json"},
+			expClosed: []string{},
+		},
+		{
+			name:      "status after down",
+			args:      []string{"status", "--json"},
+			expStates: map[string]string{"a": stateStopped, "b": stateStopped},
+		},
+		{
+			name:       "up with a failing session",
+			config:     "data/TestCommands_failing.toml",
+			args:       []string{"up", "--json"},
+			expCode:    1,
+			expResults: map[string]string{"a": "failed", "b": "skipped"},
+		},
+		{
+			name:    "validate",
+			args:    []string{"validate", "--json"},
+			expCode: 0,
+		},
+		{
+			name:    "validate an invalid config",
+			config:  "data/TestCommands_invalid.toml",
+			args:    []string{"validate", "--json"},
+			expCode: 1,
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"nosuch"},
+			expCode: 1,
+		},
+	}
+
+	for _, step := range steps {
+		// Later steps depend on earlier ones.
+		if !t.Run(step.name, func(t *testing.T) {
+			if step.before != nil {
+				step.before(t)
+			}
+			cfg := step.config
+			if cfg == "" {
+				cfg = "data/TestCommands.toml"
+			}
+			out, code := runApp(t, append([]string{"-c", cfg, "--backend", backend.Pty}, step.args...)...)
+			require.Equal(t, step.expCode, code, out)
+
+			switch {
+			case step.expResults != nil:
+				var results []sessionResult
+				require.NoError(t, json.Unmarshal([]byte(out), &results), out)
+				statuses := map[string]string{}
+				for _, r := range results {
+					statuses[r.Name] = r.Status
+				}
+				require.Equal(t, step.expResults, statuses)
+			case step.expStates != nil:
+				var states []sessionStatus
+				require.NoError(t, json.Unmarshal([]byte(out), &states), out)
+				got := map[string]string{}
+				for _, s := range states {
+					got[s.Name] = s.State
+				}
+				require.Equal(t, step.expStates, got)
+			case step.expClosed != nil:
+				var down struct {
+					ClosedWindows []string `json:"closed_windows"`
+				}
+				require.NoError(t, json.Unmarshal([]byte(out), &down), out)
+				require.Equal(t, step.expClosed, down.ClosedWindows)
+			}
+		}) {
+			t.FailNow()
+		}
+	}
+}
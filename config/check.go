@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Problem is a problem found in a config, at the position of the key it is
+// about.
+type Problem struct {
+	Position
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Position, p.Message)
+}
+
+// Check loads the config files at paths like LoadConfig, and reports every
+// problem the loader finds at the position of the key it is about. Problems
+// that keep the config from loading further, like syntax errors and
+// unexpected fields, are reported before any others.
+func Check(paths ...string) []Problem {
+	if len(paths) == 0 {
+		return []Problem{{Message: "no config file"}}
+	}
+
+	index := positions{}
+	var problems []Problem
+	rawConfig := map[string]interface{}{}
+	for _, path := range paths {
+		raw, err := loadRawFile(path, nil, index)
+		if err != nil {
+			problems = append(problems, toProblem(err, Position{File: path}, index))
+			continue
+		}
+		merge(rawConfig, raw)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	_, err := newConfig(rawConfig, paths[0], index)
+	for _, err := range flattenErrors(err) {
+		problems = append(problems, toProblem(err, Position{File: paths[0]}, index))
+	}
+	return sortProblems(problems)
+}
+
+// toProblem locates err with its position or key, or else at pos.
+func toProblem(err error, pos Position, index positions) Problem {
+	var pe *posError
+	if errors.As(err, &pe) {
+		return Problem{Position: pe.pos, Message: pe.err.Error()}
+	}
+	var ke *keyError
+	if errors.As(err, &ke) {
+		if keyPos, ok := index.lookup(ke.key); ok {
+			pos = keyPos
+		}
+	}
+	return Problem{Position: pos, Message: err.Error()}
+}
+
+// flattenErrors splits multierror errors into their parts.
+func flattenErrors(err error) []error {
+	if merr, ok := err.(*multierror.Error); ok {
+		var errs []error
+		for _, err := range merr.Errors {
+			errs = append(errs, flattenErrors(err)...)
+		}
+		return errs
+	}
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
+
+func sortProblems(problems []Problem) []Problem {
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return problems
+}
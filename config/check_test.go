@@ -0,0 +1,93 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		paths       []string
+		expProblems []string
+	}{
+		{
+			name:  "fields",
+			paths: []string{"data/TestCheck.toml"},
+			expProblems: []string{
+				`data/TestCheck.toml:2:1: unexpected field "diretcory"`,
+				`data/TestCheck.toml:6:1: sessions.setup.retries must be an integer`,
+				`data/TestCheck.toml:15:1: unexpected field "ready.wumbo" in sessions.server`,
+				`data/TestCheck.toml:16:1: sessions.server.ready.timeout must be a duration, like "500ms" or "2m"`,
+				`data/TestCheck.toml:22:18: empty session config section sessions.worker.2`,
+			},
+		},
+		{
+			name:  "semantic",
+			paths: []string{"data/TestCheck-semantic.toml"},
+			expProblems: []string{
+				`data/TestCheck-semantic.toml:5:1: in session "setup": retries requires on_failure = "retry"`,
+				`data/TestCheck-semantic.toml:8:1: in session "server": depends_on "setpu": no such session (did you mean "setup"?)`,
+				`data/TestCheck-semantic.toml:10:1: in session "server": on_failure must be one of "stop", "continue" or "retry", got "ignore"`,
+				`data/TestCheck-semantic.toml:12:18: in session "worker.1": one of script or inject is required`,
+				`data/TestCheck-semantic.toml:13:1: in session "worker.1": invalid environment variable name "MY-VAR"`,
+			},
+		},
+		{
+			name:        "syntax",
+			paths:       []string{"data/TestCheck-syntax.toml"},
+			expProblems: []string{`data/TestCheck-syntax.toml:4:21: toml: literal strings cannot have new lines`},
+		},
+		{
+			name:  "yaml",
+			paths: []string{"data/TestCheck.yaml"},
+			expProblems: []string{
+				`data/TestCheck.yaml:5:5: unexpected field "wumbo" in sessions.setup`,
+				`data/TestCheck.yaml:8:5: sessions.server.depends_on must be a list of strings`,
+			},
+		},
+		{
+			// The problem is reported where the overlay sets the value.
+			name:        "overlay",
+			paths:       []string{"data/TestLoadConfigInclude.toml", "data/TestCheck-overlay.toml"},
+			expProblems: []string{`data/TestCheck-overlay.toml:2:1: in session "server": on_failure must be one of "stop", "continue" or "retry", got "never"`},
+		},
+		{
+			name:  "valid",
+			paths: []string{"data/TestLoadConfigInclude.toml", "data/TestLoadConfigInclude-local.toml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var problems []string
+			for _, p := range Check(tt.paths...) {
+				problems = append(problems, p.String())
+			}
+			require.Equal(t, tt.expProblems, problems)
+		})
+	}
+}
+
+// Check reports the problems LoadConfig fails with, since both come from the
+// same loader.
+func TestCheckLoadConfig(t *testing.T) {
+	paths, err := filepath.Glob("data/TestLoadConfig_*")
+	require.NoError(t, err)
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			_, err := LoadConfig(path)
+			problems := Check(path)
+			if err == nil {
+				require.Empty(t, problems)
+				return
+			}
+			require.NotEmpty(t, problems, err.Error())
+			for _, p := range problems {
+				require.Contains(t, err.Error(), p.Message)
+			}
+		})
+	}
+}
@@ -1,18 +1,48 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/hashicorp/go-multierror"
+	"github.com/pglass/iterm-tool/dag"
 )
 
 type Config struct {
-	ID        string `validate:"required"`
+	ID string `validate:"required"`
+	// Directory is where sessions start, unless they set their own.
 	Directory string
-	Sessions  map[string]*Session `validate:"gte=1"`
+	// Backend selects the terminal to run sessions in. Defaults to iterm2.
+	Backend string `validate:"omitempty,oneof=iterm2 tmux pty"`
+	// Vars can be used in templates in the config, as {{ .Vars.name }}.
+	Vars map[string]any
+	// Env and EnvFile set environment variables for every session.
+	Env      map[string]string
+	EnvFile  []string            `mapstructure:"env_file"`
+	Sessions map[string]*Session `validate:"gte=1"`
+	// Layout arranges the sessions in the first tab of the main window. See
+	// LayoutTree for the default.
+	Layout *Layout
+	// Tabs configures the tabs that sessions name.
+	Tabs map[string]*Tab
+
+	// BaseDir is the directory holding the config file. Relative paths in the
+	// config are relative to it, unless they were set by another file.
+	BaseDir string `mapstructure:"-"`
+
+	// index holds where keys were set, to resolve relative paths against the
+	// file that set them.
+	index positions
 }
 
 func (c Config) Validate() error {
@@ -22,14 +52,91 @@ func (c Config) Validate() error {
 	}
 
 	var errs error
+	if err := validateEnvNames(c.Env); err != nil {
+		errs = multierror.Append(errs, atKey("env", fmt.Errorf("in env: %w", err)))
+	}
 	for _, s := range c.Sessions {
 		if err := s.Validate(); err != nil {
 			errs = multierror.Append(errs, err)
 		}
 	}
+	if err := c.validateDependencies(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := c.validateTabs(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
 	return errs
 }
 
+// validateDependencies checks that every depends_on names a session, and
+// that sessions do not depend on each other in a cycle. Either would leave
+// sessions waiting forever.
+func (c Config) validateDependencies() error {
+	names := slices.Sorted(maps.Keys(c.Sessions))
+
+	var errs error
+	for _, name := range names {
+		for _, dep := range c.Sessions[name].Dependencies() {
+			if _, ok := c.Sessions[dep]; ok {
+				continue
+			}
+			msg := fmt.Sprintf("in session %q: depends_on %q: no such session", name, dep)
+			if suggestion := closest(dep, names); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+			errs = multierror.Append(errs, atKey(sessionKey(name, "depends_on"), errors.New(msg)))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	err := dag.FindCycle(names, func(name string) []string {
+		deps := c.Sessions[name].Dependencies()
+		sort.Strings(deps)
+		return deps
+	})
+	var cycle *dag.CycleError
+	if errors.As(err, &cycle) {
+		return atKey(sessionKey(cycle.Cycle[0], "depends_on"), err)
+	}
+	return err
+}
+
+// closest returns the name nearest to s by edit distance, if any is close enough
+// to be a likely typo.
+func closest(s string, names []string) string {
+	best, bestDist := "", len(s)/2+1
+	for _, name := range names {
+		if d := editDistance(s, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
 func (c Config) SessionsByGroup() map[string][]*Session {
 	result := map[string][]*Session{}
 	for _, sess := range c.Sessions {
@@ -47,18 +154,227 @@ func (c Config) SessionsByGroup() map[string][]*Session {
 	return result
 }
 
+// Dependents returns names along with every session that depends on one of
+// them, directly or through other sessions, in sorted order.
+func (c Config) Dependents(names []string) []string {
+	found := map[string]bool{}
+	for _, name := range names {
+		found[name] = true
+	}
+	// Look for more dependents until there are none. Configs are small.
+	for more := true; more; {
+		more = false
+		for name, sess := range c.Sessions {
+			if found[name] {
+				continue
+			}
+			for _, dep := range sess.Dependencies() {
+				if found[dep] {
+					found[name], more = true, true
+					break
+				}
+			}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(found))
+}
+
+// What to do when a session's script exits with a non-zero status.
+// Sessions that depend on a failed session are always skipped.
+const (
+	// OnFailureStop starts no more sessions. This is the default.
+	OnFailureStop = "stop"
+	// OnFailureContinue keeps starting sessions that do not depend on the failed one.
+	OnFailureContinue = "continue"
+	// OnFailureRetry runs the script again, up to Retries more times, and then stops.
+	OnFailureRetry = "retry"
+)
+
 type Session struct {
-	Name      string
+	Name string
+	// Directory is where the session's shell starts. Defaults to the
+	// top-level directory.
+	Directory string
 	DependsOn []string `mapstructure:"depends_on"`
 	Script    string
 	Inject    string
+	OnFailure string `mapstructure:"on_failure"`
+	// Retries is how many times to rerun a failed script with on_failure = "retry".
+	// Defaults to 1.
+	Retries int
+	// Ready tells when the session is ready for its dependents, which
+	// otherwise start as soon as the session's script is done.
+	Ready *Ready `mapstructure:"ready"`
+	// Env and EnvFile set environment variables for this session. They take
+	// precedence over the top-level env and env_file.
+	Env     map[string]string
+	EnvFile []string `mapstructure:"env_file"`
+
+	// Tab and Window name the tab and window the session runs in. Sessions
+	// run in the first tab of the main window by default. A session in a
+	// configured tab defaults to the window of the tab.
+	Tab    string
+	Window string
+
+	// Disabled removes the session, along with dependencies on it. This is
+	// useful to turn off a session defined in an included file.
+	Disabled bool
+
+	// environment and workDir are resolved by LoadConfig.
+	environment map[string]string
+	workDir     string
+}
+
+// WorkDir returns the absolute path of the session's working directory, or
+// "" if neither the session nor the config sets a directory.
+func (s Session) WorkDir() string {
+	return s.workDir
+}
+
+// Environment returns the session's environment variables, merged from the
+// top-level and session env and env_file.
+func (s Session) Environment() map[string]string {
+	return s.environment
+}
+
+// Hash identifies what the session runs. A session that is still running
+// with the same hash does not need to be restarted. Where the session runs,
+// and what it depends on, are not part of the hash.
+func (s Session) Hash() string {
+	data, err := json.Marshal(struct {
+		Directory string
+		Env       map[string]string
+		Script    string
+		Inject    string
+		OnFailure string
+		Retries   int
+		Ready     *Ready
+	}{s.workDir, s.environment, s.Script, s.Inject, s.OnFailure, s.Retries, s.Ready})
+	if err != nil {
+		// Every field can be marshaled.
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Ready describes how to tell that a session is ready, for example that the
+// server it injects is listening. Every check that is set must pass.
+type Ready struct {
+	// TCP is a host:port that accepts connections.
+	TCP string
+	// HTTP is a URL that answers a GET with Status.
+	HTTP string
+	// Status is the expected HTTP status. Defaults to any 2xx status.
+	Status int
+	// File is a path that exists, relative to the session's directory.
+	File string
+	// Match is a regular expression that matches the session's output.
+	Match string
+	// Command is a shell command that exits with status zero. It runs in the
+	// session's directory, with the session's environment.
+	Command string
+
+	// Interval is the time between checks. Defaults to 1s.
+	Interval time.Duration
+	// Timeout is how long to wait for all checks to pass. Defaults to 60s.
+	Timeout time.Duration
+}
+
+func (r Ready) Validate() error {
+	if r.TCP == "" && r.HTTP == "" && r.File == "" && r.Match == "" && r.Command == "" {
+		return errors.New("ready needs at least one of tcp, http, file, match or command")
+	}
+	if r.Status != 0 && r.HTTP == "" {
+		return errors.New("ready.status requires ready.http")
+	}
+	if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+		return fmt.Errorf("ready.status %d is not an HTTP status", r.Status)
+	}
+	if _, err := regexp.Compile(r.Match); err != nil {
+		return fmt.Errorf("ready.match: %w", err)
+	}
+	if r.Interval < 0 || r.Timeout < 0 {
+		return errors.New("ready.interval and ready.timeout must not be negative")
+	}
+	return nil
+}
+
+// CheckInterval returns Interval, or its default if it is unset.
+func (r Ready) CheckInterval() time.Duration {
+	if r.Interval == 0 {
+		return time.Second
+	}
+	return r.Interval
+}
+
+// WaitTimeout returns Timeout, or its default if it is unset.
+func (r Ready) WaitTimeout() time.Duration {
+	if r.Timeout == 0 {
+		return 60 * time.Second
+	}
+	return r.Timeout
 }
 
 func (s Session) Validate() error {
+	var errs error
+	fail := func(field string, err error) {
+		errs = multierror.Append(errs, atKey(sessionKey(s.Name, field), fmt.Errorf("in session %q: %w", s.Name, err)))
+	}
+
 	if s.Script == "" && s.Inject == "" {
-		return fmt.Errorf("in session %q: one of script or inject is required", s.Name)
+		fail("", errors.New("one of script or inject is required"))
 	}
-	return nil
+	switch s.OnFailure {
+	case "", OnFailureStop, OnFailureContinue, OnFailureRetry:
+	default:
+		fail("on_failure", fmt.Errorf("on_failure must be one of %q, %q or %q, got %q",
+			OnFailureStop, OnFailureContinue, OnFailureRetry, s.OnFailure))
+	}
+	if s.Retries < 0 {
+		fail("retries", errors.New("retries must not be negative"))
+	} else if s.Retries != 0 && s.OnFailure != OnFailureRetry {
+		fail("retries", fmt.Errorf("retries requires on_failure = %q", OnFailureRetry))
+	}
+	if err := validateEnvNames(s.Env); err != nil {
+		fail("env", err)
+	}
+	if s.Ready != nil {
+		if err := s.Ready.Validate(); err != nil {
+			fail("ready", err)
+		}
+	}
+	return errs
+}
+
+// Dependencies returns the names of the sessions in DependsOn, which may be
+// written with or without the "sessions." prefix.
+func (s Session) Dependencies() []string {
+	var names []string
+	for _, dep := range s.DependsOn {
+		names = append(names, strings.TrimPrefix(dep, "sessions."))
+	}
+	return names
+}
+
+// FailurePolicy returns OnFailure, or the default policy if it is unset.
+func (s Session) FailurePolicy() string {
+	if s.OnFailure == "" {
+		return OnFailureStop
+	}
+	return s.OnFailure
+}
+
+// Attempts is how many times to run the script before giving up.
+func (s Session) Attempts() int {
+	if s.FailurePolicy() != OnFailureRetry {
+		return 1
+	}
+	if s.Retries == 0 {
+		return 2
+	}
+	return 1 + s.Retries
 }
 
 // Group is a session grouping.
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHash(t *testing.T) {
+	base := Session{Name: "server", Inject: "make serve", environment: map[string]string{"PORT": "8080"}}
+	hash := base.Hash()
+
+	// Where the session runs, and what it depends on, do not matter.
+	moved := base
+	moved.Tab, moved.DependsOn = "servers", []string{"setup"}
+	require.Equal(t, hash, moved.Hash())
+
+	for name, change := range map[string]func(s *Session){
+		"inject":    func(s *Session) { s.Inject = "make serve-dev" },
+		"script":    func(s *Session) { s.Script = "make build" },
+		"env":       func(s *Session) { s.environment = map[string]string{"PORT": "8081"} },
+		"directory": func(s *Session) { s.workDir = "/tmp" },
+		"ready":     func(s *Session) { s.Ready = &Ready{TCP: "localhost:8080"} },
+	} {
+		changed := base
+		change(&changed)
+		require.NotEqual(t, hash, changed.Hash(), name)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	cfg := Config{Sessions: map[string]*Session{
+		"setup":    {Name: "setup"},
+		"db":       {Name: "db"},
+		"server":   {Name: "server", DependsOn: []string{"sessions.setup", "db"}},
+		"worker.1": {Name: "worker.1", DependsOn: []string{"sessions.server"}},
+		"worker.2": {Name: "worker.2", DependsOn: []string{"setup"}},
+	}}
+
+	require.Equal(t, []string{"db", "server", "worker.1"}, cfg.Dependents([]string{"db"}))
+	require.Equal(t, []string{"server", "setup", "worker.1", "worker.2"}, cfg.Dependents([]string{"setup"}))
+	require.Equal(t, []string{"worker.1", "worker.2"}, cfg.Dependents([]string{"worker.2", "worker.1"}))
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// resolveDirectories computes the working directory of every session: its
+// own directory, or else the top-level one. It expands a leading ~ and
+// environment variables, makes relative paths relative to the config file
+// that sets them, and checks that the directory exists. It must run after
+// resolveEnv.
+func (c *Config) resolveDirectories() error {
+	var errs error
+	for _, s := range c.Sessions {
+		dir, key := s.Directory, sessionKey(s.Name, "directory")
+		if dir == "" {
+			dir, key = c.Directory, "directory"
+		}
+		if dir == "" {
+			continue
+		}
+
+		resolved, err := c.resolveDirectory(dir, c.baseDir(key), s.environment)
+		if err != nil {
+			errs = multierror.Append(errs, atKey(key, fmt.Errorf("in session %q: directory %q: %w", s.Name, dir, err)))
+			continue
+		}
+		s.workDir = resolved
+	}
+	return errs
+}
+
+func (c *Config) resolveDirectory(dir, base string, env map[string]string) (string, error) {
+	dir = expandEnv(dir, env)
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, dir[1:])
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(base, dir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// baseDir returns the directory that a relative path at key is relative to:
+// that of the file that set key, or else BaseDir.
+func (c *Config) baseDir(key string) string {
+	pos, ok := c.index[key]
+	if !ok {
+		return c.BaseDir
+	}
+	abs, err := filepath.Abs(pos.File)
+	if err != nil {
+		return c.BaseDir
+	}
+	return filepath.Dir(abs)
+}
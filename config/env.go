@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// envNameRe matches names the shell accepts in `export NAME=value`.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func validateEnvNames(env map[string]string) error {
+	for name := range env {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// resolveEnv computes the environment of every session. From lowest to
+// highest precedence, it merges the top-level env_file and env, then the
+// session's env_file and env.
+func (c *Config) resolveEnv() error {
+	base, err := c.mergeEnv(nil, c.EnvFile, c.Env)
+	if err != nil {
+		return atKey("env_file", err)
+	}
+	var errs error
+	for _, s := range c.Sessions {
+		env, err := c.mergeEnv(base, s.EnvFile, s.Env)
+		if err != nil {
+			errs = multierror.Append(errs, atKey(sessionKey(s.Name, "env_file"), fmt.Errorf("in session %q: %w", s.Name, err)))
+			continue
+		}
+		s.environment = env
+	}
+	return errs
+}
+
+// mergeEnv returns a copy of env with files and then vars applied. ${VAR}
+// references in values refer to variables set so far, falling back to the
+// tool's own environment.
+func (c *Config) mergeEnv(env map[string]string, files []string, vars map[string]string) (map[string]string, error) {
+	result := maps.Clone(env)
+	if result == nil {
+		result = map[string]string{}
+	}
+	for _, path := range files {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(c.BaseDir, path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("env_file: %w", err)
+		}
+		err = parseEnvFile(f, result)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("env_file %s: %w", path, err)
+		}
+	}
+
+	// Expand against the variables from files, so that vars does not see
+	// itself in a random order.
+	lookup := maps.Clone(result)
+	for name, value := range vars {
+		result[name] = expandEnv(value, lookup)
+	}
+	return result, nil
+}
+
+func expandEnv(s string, env map[string]string) string {
+	return os.Expand(s, func(name string) string {
+		if value, ok := env[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+// parseEnvFile reads a dotenv file into env. Lines look like NAME=value,
+// optionally preceded by `export`. Values may be single quoted (taken
+// literally) or double quoted (with \n, \", \\ escapes). Unquoted and double
+// quoted values expand ${VAR} references. Lines starting with # are comments,
+// as is the rest of an unquoted value after " #".
+func parseEnvFile(r io.Reader, env map[string]string) error {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !envNameRe.MatchString(name) {
+			return fmt.Errorf("line %d: expected NAME=value", lineNo)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated single quote", lineNo)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := unquoteDouble(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			value = expandEnv(unquoted, env)
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			value = expandEnv(value, env)
+		}
+		env[name] = value
+	}
+	return scanner.Err()
+}
+
+func unquoteDouble(s string) (string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", fmt.Errorf("unterminated double quote")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated double quote")
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeRaw decodes a config file into a raw map. The format is chosen by the
+// extension of name: .yaml or .yml for YAML, .json for JSON, and TOML
+// otherwise.
+//
+// The formats nest tables the same way, so `sessions.worker.1` in TOML is
+// `{"sessions": {"worker": {"1": ...}}}` in JSON. Values are normalized to
+// the types the TOML decoder produces, so that all formats decode to the
+// same Config.
+func decodeRaw(name string, r io.Reader) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if err := yaml.NewDecoder(r).Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	case ".json":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+	default:
+		if err := toml.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, err
+		}
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	normalized, err := normalize(raw)
+	if err != nil {
+		return nil, err
+	}
+	return normalized.(map[string]interface{}), nil
+}
+
+// normalize converts YAML and JSON values to their TOML equivalents:
+//
+//   - YAML maps with non-string keys, like `1:` under a group, get string keys.
+//   - Integers become int64, and other JSON numbers become float64.
+func normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			n, err := normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = n
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			n, err := normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = n
+		}
+		return m, nil
+	case []interface{}:
+		for i, val := range v {
+			n, err := normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+		return v, nil
+	case int:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	}
+	return v, nil
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// loadRawFile reads a config file into a raw map, with the files it
+// includes merged underneath it. Includes are relative to the including
+// file. stack holds the files being loaded, to detect include cycles. The
+// positions of keys are added to index.
+func loadRawFile(path string, stack []string, index positions) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		cycle := append(stack[slices.Index(stack, abs):], abs)
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+	}
+	stack = append(stack, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decodeRaw(path, bytes.NewReader(data))
+	if err != nil {
+		return nil, syntaxError(path, data, err)
+	}
+	resolveEnvFiles(raw, filepath.Dir(abs))
+	local := indexPositions(path, data)
+
+	// includeError positions err at the include key, unless it already has
+	// a position in an included file.
+	includeError := func(err error) error {
+		var pe *posError
+		if errors.As(err, &pe) {
+			return err
+		}
+		pos, ok := local["include"]
+		if !ok {
+			pos = Position{File: path}
+		}
+		return &posError{pos: pos, err: err}
+	}
+
+	result := map[string]interface{}{}
+	if rawIncludes, ok := raw["include"]; ok {
+		delete(raw, "include")
+		includes, ok := rawIncludes.([]interface{})
+		if !ok {
+			return nil, includeError(errors.New("include must be a list of paths"))
+		}
+		for _, include := range includes {
+			includePath, ok := include.(string)
+			if !ok {
+				return nil, includeError(errors.New("include must be a list of paths"))
+			}
+			if !filepath.IsAbs(includePath) {
+				includePath = filepath.Join(filepath.Dir(abs), includePath)
+			}
+			included, err := loadRawFile(includePath, stack, index)
+			if err != nil {
+				return nil, includeError(err)
+			}
+			merge(result, included)
+		}
+	}
+	merge(result, raw)
+	maps.Copy(index, local)
+	return result, nil
+}
+
+// resolveEnvFiles makes the relative env_file paths in raw, a config file in
+// dir, relative to dir, so that they keep pointing at the same files once
+// merged with other files. Values of the wrong type are left for the decoder
+// to report.
+func resolveEnvFiles(raw map[string]interface{}, dir string) {
+	fields := configFields(reflect.TypeOf(Session{}))
+
+	// resolve resolves the env_file of table, and of the sessions nested in
+	// it, which are its tables that are not fields, like env.
+	var resolve func(table map[string]interface{}, nested bool)
+	resolve = func(table map[string]interface{}, nested bool) {
+		for _, key := range []string{"env_file", "env_file+"} {
+			switch value := table[key].(type) {
+			case string:
+				table[key] = joinDir(dir, value)
+			case []interface{}:
+				for i, path := range value {
+					if path, ok := path.(string); ok {
+						value[i] = joinDir(dir, path)
+					}
+				}
+			}
+		}
+		if !nested {
+			return
+		}
+		for name, value := range table {
+			if _, ok := fields[name]; ok {
+				continue
+			}
+			if session, ok := value.(map[string]interface{}); ok {
+				resolve(session, true)
+			}
+		}
+	}
+
+	resolve(raw, false)
+	sessions, _ := raw["sessions"].(map[string]interface{})
+	for _, session := range sessions {
+		if session, ok := session.(map[string]interface{}); ok {
+			resolve(session, true)
+		}
+	}
+}
+
+// joinDir returns path relative to dir, unless it is absolute.
+func joinDir(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// merge merges src into dst:
+//
+//   - Tables are merged key by key, so sessions are merged by name, and a
+//     session in src only overrides the fields it sets.
+//   - Other values in src replace those in dst, including lists.
+//   - A key ending in "+", like `"depends_on+" = ["db"]`, appends its list to
+//     the list in dst instead. Appends apply after the values src sets, so
+//     `depends_on` and `"depends_on+"` in one table append to the former.
+func merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if strings.HasSuffix(key, "+") {
+			continue
+		}
+		srcMap, ok := value.(map[string]interface{})
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstMap = map[string]interface{}{}
+			dst[key] = dstMap
+		}
+		merge(dstMap, srcMap)
+	}
+
+	for key, value := range src {
+		name, ok := strings.CutSuffix(key, "+")
+		if !ok {
+			continue
+		}
+		existing, _ := dst[name].([]interface{})
+		added, ok := value.([]interface{})
+		if !ok {
+			added = []interface{}{value}
+		}
+		dst[name] = append(slices.Clone(existing), added...)
+	}
+}
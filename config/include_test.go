@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string]interface{}
+		src  map[string]interface{}
+
+		exp map[string]interface{}
+	}{
+		{
+			name: "replace",
+			dst:  map[string]interface{}{"id": "a", "depends_on": []interface{}{"db"}},
+			src:  map[string]interface{}{"depends_on": []interface{}{}},
+			exp:  map[string]interface{}{"id": "a", "depends_on": []interface{}{}},
+		},
+		{
+			name: "append",
+			dst:  map[string]interface{}{"depends_on": []interface{}{"db"}},
+			src:  map[string]interface{}{"depends_on+": []interface{}{"cache"}},
+			exp:  map[string]interface{}{"depends_on": []interface{}{"db", "cache"}},
+		},
+		{
+			name: "append to nothing",
+			dst:  map[string]interface{}{},
+			src:  map[string]interface{}{"depends_on+": "cache"},
+			exp:  map[string]interface{}{"depends_on": []interface{}{"cache"}},
+		},
+		{
+			name: "replace and append",
+			dst:  map[string]interface{}{"depends_on": []interface{}{"db"}},
+			src: map[string]interface{}{
+				"depends_on":  []interface{}{"setup"},
+				"depends_on+": []interface{}{"cache"},
+			},
+			exp: map[string]interface{}{"depends_on": []interface{}{"setup", "cache"}},
+		},
+		{
+			name: "tables",
+			dst: map[string]interface{}{"sessions": map[string]interface{}{
+				"server": map[string]interface{}{"inject": "make serve", "depends_on": []interface{}{"db"}},
+			}},
+			src: map[string]interface{}{"sessions": map[string]interface{}{
+				"server": map[string]interface{}{"depends_on": []interface{}{"setup"}, "depends_on+": []interface{}{"cache"}},
+				"client": map[string]interface{}{"inject": "make client"},
+			}},
+			exp: map[string]interface{}{"sessions": map[string]interface{}{
+				"server": map[string]interface{}{"inject": "make serve", "depends_on": []interface{}{"setup", "cache"}},
+				"client": map[string]interface{}{"inject": "make client"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Maps iterate in a random order, which must not matter.
+			for i := 0; i < 20; i++ {
+				dst := map[string]interface{}{}
+				merge(dst, tt.dst)
+				merge(dst, tt.src)
+				require.Equal(t, tt.exp, dst)
+			}
+		})
+	}
+}
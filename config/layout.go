@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pglass/iterm-tool/layout"
+)
+
+// Layout arranges the sessions in the window. Each entry holds a session,
+// or divides its space into rows or columns of entries.
+type Layout struct {
+	// Session names the session in this pane, with or without the
+	// "sessions." prefix.
+	Session string
+	// Size is the share of the parent's space, relative to the entries next
+	// to this one. Defaults to 1.
+	Size float64
+	// Rows stack entries top to bottom.
+	Rows []*Layout
+	// Columns place entries side by side.
+	Columns []*Layout
+}
+
+// decodeLayout decodes the layout section at key like decodeStrict, along
+// with its entries, which are named after their list and index, like
+// "layout.columns[0]".
+func decodeLayout(key string, raw interface{}) (*Layout, error) {
+	table, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, atKey(key, fmt.Errorf("%s must be a table", key))
+	}
+	rest := map[string]interface{}{}
+	entries := map[string]interface{}{}
+	for field, value := range table {
+		switch strings.ToLower(field) {
+		case "rows", "columns":
+			entries[field] = value
+		default:
+			rest[field] = value
+		}
+	}
+
+	var result Layout
+	var errs error
+	if err := decodeStrict(key, rest, &result); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	for _, field := range slices.Sorted(maps.Keys(entries)) {
+		fieldKey := joinKey(key, field)
+		list, ok := entries[field].([]interface{})
+		if !ok {
+			errs = multierror.Append(errs, atKey(fieldKey, fmt.Errorf("%s must be a list of tables", fieldKey)))
+			continue
+		}
+		// An empty list is still set, for validateLayout to report.
+		decoded := []*Layout{}
+		for i, entry := range list {
+			l, err := decodeLayout(fmt.Sprintf("%s[%d]", fieldKey, i), entry)
+			if err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			decoded = append(decoded, l)
+		}
+		if strings.ToLower(field) == "rows" {
+			result.Rows = decoded
+		} else {
+			result.Columns = decoded
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return &result, nil
+}
+
+// sessionName returns the session named by l, without the "sessions." prefix.
+func (l *Layout) sessionName() string {
+	return strings.TrimPrefix(l.Session, "sessions.")
+}
+
+// without returns l with the sessions in names removed, or nil if nothing is
+// left of it.
+func (l *Layout) without(names map[string]bool) *Layout {
+	if l.Session != "" {
+		if names[l.sessionName()] {
+			return nil
+		}
+		return l
+	}
+	prune := func(entries []*Layout) []*Layout {
+		var result []*Layout
+		for _, entry := range entries {
+			if entry := entry.without(names); entry != nil {
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+	result := &Layout{Size: l.Size, Rows: prune(l.Rows), Columns: prune(l.Columns)}
+	if len(result.Rows) == 0 && len(result.Columns) == 0 {
+		return nil
+	}
+	return result
+}
+
+// validateLayout checks that every entry of l, the layout at key, is either
+// a session, rows or columns, and that it holds every session at p exactly
+// once.
+func (c Config) validateLayout(key string, l *Layout, p Place) error {
+	if l == nil {
+		return nil
+	}
+
+	var errs error
+	fail := func(format string, args ...any) {
+		errs = multierror.Append(errs, atKey(key, fmt.Errorf(key+": "+format, args...)))
+	}
+	sessions := c.SessionsAt(p)
+	seen := map[string]bool{}
+	var visit func(l *Layout)
+	visit = func(l *Layout) {
+		kinds := 0
+		for _, set := range []bool{l.Session != "", l.Rows != nil, l.Columns != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			fail("each entry needs exactly one of session, rows or columns")
+			return
+		}
+		if l.Size < 0 {
+			fail("size must not be negative, got %v", l.Size)
+		}
+		if l.Session != "" {
+			name := l.sessionName()
+			switch {
+			case c.Sessions[name] != nil && sessions[name] == nil:
+				fail("session %q is in another tab", name)
+			case sessions[name] == nil:
+				msg := fmt.Sprintf("no such session %q", name)
+				if suggestion := closest(name, slices.Sorted(maps.Keys(sessions))); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				fail("%s", msg)
+			case seen[name]:
+				fail("session %q appears more than once", name)
+			}
+			seen[name] = true
+			return
+		}
+		if len(l.Rows) == 0 && len(l.Columns) == 0 {
+			fail("rows and columns must not be empty")
+		}
+		for _, entry := range slices.Concat(l.Rows, l.Columns) {
+			visit(entry)
+		}
+	}
+	visit(l)
+	if errs != nil {
+		return errs
+	}
+
+	var missing []string
+	for _, name := range slices.Sorted(maps.Keys(sessions)) {
+		if !seen[name] {
+			missing = append(missing, fmt.Sprintf("%q", name))
+		}
+	}
+	if len(missing) > 0 {
+		return atKey(key, fmt.Errorf("%s: missing sessions %s", key, strings.Join(missing, ", ")))
+	}
+	return nil
+}
+
+// LayoutTree returns how to arrange the sessions of the tab at p: its
+// layout, or by default a column per group with the sessions of the group in
+// rows, both sorted by name.
+func (c Config) LayoutTree(p Place) *layout.Node {
+	l := c.TabLayout(p)
+	if l == nil {
+		var groups [][]string
+		byGroup := Config{Sessions: c.SessionsAt(p)}.SessionsByGroup()
+		for _, group := range slices.Sorted(maps.Keys(byGroup)) {
+			var names []string
+			for _, s := range byGroup[group] {
+				names = append(names, s.Name)
+			}
+			groups = append(groups, names)
+		}
+		return layout.Default(groups)
+	}
+
+	var convert func(l *Layout) *layout.Node
+	convert = func(l *Layout) *layout.Node {
+		if l.Session != "" {
+			return &layout.Node{Session: l.sessionName(), Size: l.Size}
+		}
+		n := &layout.Node{Size: l.Size, Columns: l.Columns != nil}
+		for _, entry := range slices.Concat(l.Rows, l.Columns) {
+			n.Children = append(n.Children, convert(entry))
+		}
+		return n
+	}
+	return convert(l)
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pglass/iterm-tool/layout"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayoutTree(t *testing.T) {
+	load := func(name string) *Config {
+		f, err := dataFS.Open("data/TestLoadConfig_" + name + ".toml")
+		require.NoError(t, err)
+		cfg, err := loadConfigFile(f)
+		require.NoError(t, err)
+		return cfg
+	}
+
+	// By default, a column per group, with groups and their sessions sorted
+	// by name.
+	require.Equal(t, &layout.Node{Columns: true, Children: []*layout.Node{
+		{Children: []*layout.Node{layout.Leaf("nested"), layout.Leaf("nested.1"), layout.Leaf("nested.2")}},
+		layout.Leaf("server"),
+		layout.Leaf("setup"),
+	}}, load("success").LayoutTree(Place{}))
+
+	require.Equal(t, &layout.Node{Children: []*layout.Node{
+		{Size: 3, Columns: true, Children: []*layout.Node{
+			{Session: "editor", Size: 2},
+			layout.Leaf("server"),
+		}},
+		layout.Leaf("shell"),
+	}}, load("layout").LayoutTree(Place{}))
+}
@@ -4,26 +4,87 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
-	"os"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-viper/mapstructure/v2"
-	"github.com/pelletier/go-toml/v2"
+	"github.com/hashicorp/go-multierror"
 )
 
-func LoadConfig(path string) (*Config, error) {
-	f, err := os.Open(path)
+// LoadConfig loads the config files at paths, merging each file over the
+// ones before it (see merge), along with the files they include. Relative
+// paths in the config are relative to the file that sets them.
+func LoadConfig(paths ...string) (*Config, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no config file")
+	}
+
+	index := positions{}
+	rawConfig, err := loadRaw(paths, index)
+	if err != nil {
+		return nil, err
+	}
+	return newConfig(rawConfig, paths[0], index)
+}
+
+// loadRaw loads the config files at paths into a single raw map, and adds
+// the positions of their keys to index.
+func loadRaw(paths []string, index positions) (map[string]interface{}, error) {
+	rawConfig := map[string]interface{}{}
+	for _, path := range paths {
+		raw, err := loadRawFile(path, nil, index)
+		if err != nil {
+			return nil, err
+		}
+		merge(rawConfig, raw)
+	}
+	return rawConfig, nil
+}
+
+// newConfig decodes and resolves a raw config. Relative paths in it are
+// relative to the file that set them, according to index, or else to the
+// directory of path.
+func newConfig(rawConfig map[string]interface{}, path string, index positions) (*Config, error) {
+	cfg, err := decodeConfig(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
 	}
-	return loadConfigFile(f)
+	cfg.BaseDir = filepath.Dir(abs)
+	cfg.index = index
+	if err := cfg.resolveEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.resolveDirectories(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
 func loadConfigFile(f fs.File) (*Config, error) {
-	var rawConfig map[string]interface{}
-	if err := toml.NewDecoder(f).Decode(&rawConfig); err != nil {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := decodeRaw(info.Name(), f)
+	if err != nil {
 		return nil, err
 	}
+	if _, ok := rawConfig["include"]; ok {
+		return nil, errors.New("include is only supported by LoadConfig")
+	}
+	return decodeConfig(rawConfig)
+}
 
+func decodeConfig(rawConfig map[string]interface{}) (*Config, error) {
 	// This is a little silly and kind of a self-imposed problem. Maybe there's a better way.
 	//
 	// Basically, I want to use `session.<group>.name` syntax.
@@ -59,16 +120,40 @@ func loadConfigFile(f fs.File) (*Config, error) {
 	//
 	// To achieve this, I parse as a raw map[string]interface{}. I pop the "sessions"
 	// field out, and then parse that with special handling.
+	//
+	// YAML and JSON configs nest the same way, so they get the same handling.
 	rawSessions, ok := rawConfig["sessions"].(map[string]interface{})
 	if !ok || len(rawSessions) == 0 {
-		return nil, errors.New("must have at least one session config: `[sessions.<name>]`")
+		return nil, atKey("sessions", errors.New("must have at least one session config: `[sessions.<name>]`"))
 	}
 	delete(rawConfig, "sessions")
+	rawLayout, hasLayout := rawConfig["layout"]
+	delete(rawConfig, "layout")
+	rawTabs, hasTabs := rawConfig["tabs"]
+	delete(rawConfig, "tabs")
+
+	// Every problem in the shape of the config is reported, before the
+	// problems Validate finds in the decoded config.
+	var errs error
 
 	// Parse the top-level fields without "sessions"
 	var cfg Config
-	if err := mapstructure.Decode(rawConfig, &cfg); err != nil {
-		return nil, err
+	if err := decodeStrict("", rawConfig, &cfg); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if hasLayout {
+		l, err := decodeLayout("layout", rawLayout)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		cfg.Layout = l
+	}
+	if hasTabs {
+		tabs, err := decodeTabs(rawTabs)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		cfg.Tabs = tabs
 	}
 
 	// Parse the sessions.
@@ -82,58 +167,57 @@ func loadConfigFile(f fs.File) (*Config, error) {
 	// Remaining is our "work list". When we think we have a nested session config section,
 	// append to to be parsed later (doing this iteratively instead of using recursion)
 	remaining := []KeyVal{}
-	for name, rawSess := range rawSessions {
+	for _, name := range slices.Sorted(maps.Keys(rawSessions)) {
 		remaining = append(remaining, KeyVal{
 			Key: name,
-			Val: rawSess,
+			Val: rawSessions[name],
 		})
 	}
 
 	for i := 0; i < len(remaining); i++ {
 		kv := remaining[i]
-		var sess Session
+		key := sessionKey(kv.Key, "")
 
-		var metadata mapstructure.Metadata
-		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			Metadata: &metadata,
-			Result:   &sess,
-		})
-		if err != nil {
-			return nil, err
-		}
-		if err := decoder.Decode(kv.Val); err != nil {
-			return nil, err
-		}
-
-		if len(metadata.Keys) > 0 {
-			// A valid key was parsed.
-			cfg.Sessions[kv.Key] = &sess
-		}
-
-		// We may have `sessions.nested` and `sessions.nested.1` and `sessions.nested.2`.
-		// Try to parse any nested sessions.
 		rawSessAsMap, ok := kv.Val.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("session config %q is not a map: val=%v", kv.Key, kv.Val)
+		if !ok && kv.Val != nil {
+			errs = multierror.Append(errs, atKey(key, fmt.Errorf("session config %q is not a map: val=%v", kv.Key, kv.Val)))
+			continue
 		}
 		if len(rawSessAsMap) == 0 {
-			return nil, fmt.Errorf("empty session config section sessions.%s", kv.Key)
+			// Includes an empty YAML mapping, like `empty:`.
+			errs = multierror.Append(errs, atKey(key, fmt.Errorf("empty session config section %s", key)))
+			continue
 		}
 
-		for _, unused := range metadata.Unused {
-			// mapstructure can distinguish unused fields and unset fields.
-			// Unset fields are fields in the result type, while unused fields are the "unexpected" fields.
-			//
-			// We iterate over unused fields and assume that if they are maps, then we have a nested session.
-			nestSess, ok := rawSessAsMap[unused].(map[string]interface{})
-			if !ok {
-				return nil, fmt.Errorf("unexpected field %q in sessions.%s", unused, kv.Key)
+		// We may have `sessions.nested` and `sessions.nested.1` and `sessions.nested.2`.
+		// Fields of the session that are tables are nested sessions.
+		//
+		// A nil value is an empty YAML mapping, reported as an empty session.
+		nested := 0
+		var sess Session
+		err := decodeTable(rawSessAsMap, reflect.ValueOf(&sess).Elem(), key, key, "", func(name string, value interface{}) bool {
+			nestSess, ok := value.(map[string]interface{})
+			if !ok && value != nil {
+				return false
 			}
+			nested++
 			remaining = append(remaining, KeyVal{
-				Key: kv.Key + "." + unused,
+				Key: kv.Key + "." + name,
 				Val: nestSess,
 			})
+			return true
+		})
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
 		}
+		if len(rawSessAsMap) > nested {
+			// The session sets fields of its own, besides its nested sessions.
+			cfg.Sessions[kv.Key] = &sess
+		}
+	}
+	if errs != nil {
+		return nil, errs
 	}
 
 	// Sync/Surface session name.
@@ -141,6 +225,37 @@ func loadConfigFile(f fs.File) (*Config, error) {
 		s.Name = name
 	}
 
+	// Drop disabled sessions, and dependencies on them.
+	disabled := map[string]bool{}
+	for name, s := range cfg.Sessions {
+		if s.Disabled {
+			disabled[name] = true
+			delete(cfg.Sessions, name)
+		}
+	}
+	for _, s := range cfg.Sessions {
+		s.DependsOn = slices.DeleteFunc(s.DependsOn, func(dep string) bool {
+			return disabled[strings.TrimPrefix(dep, "sessions.")]
+		})
+	}
+	if cfg.Layout != nil {
+		cfg.Layout = cfg.Layout.without(disabled)
+	}
+	for _, tab := range cfg.Tabs {
+		if tab.Layout != nil {
+			tab.Layout = tab.Layout.without(disabled)
+		}
+	}
+	if len(cfg.Sessions) == 0 {
+		return nil, errors.New("all sessions are disabled")
+	}
+
+	cfg.resolveWindows()
+
+	if err := cfg.render(); err != nil {
+		return nil, err
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -148,6 +263,150 @@ func loadConfigFile(f fs.File) (*Config, error) {
 	return &cfg, nil
 }
 
+// unitError is the error for a duration written as a bare number, which
+// is surely not meant as nanoseconds: `timeout = 30` is not 30ns.
+type unitError struct {
+	value interface{}
+}
+
+func (e unitError) Error() string {
+	return fmt.Sprintf("%v has no unit, write a duration like \"%vs\"", e.value, e.value)
+}
+
+// durationHook decodes durations, which are written like "500ms" or "2m".
+// Bare numbers are a unitError.
+func durationHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			if to != reflect.TypeOf(time.Duration(0)) {
+				return data, nil
+			}
+			switch from.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				return nil, unitError{value: data}
+			}
+			return data, nil
+		},
+		mapstructure.StringToTimeDurationHookFunc(),
+	)
+}
+
+// decodeStrict decodes raw, the table at key, into result, a pointer to a
+// config struct. See decodeTable.
+func decodeStrict(key string, raw interface{}, result interface{}) error {
+	return decodeTable(raw, reflect.ValueOf(result).Elem(), key, key, "", nil)
+}
+
+// decodeTable decodes raw, the table at key, into the struct v, and reports
+// every problem in it rather than only the first: unexpected fields, and
+// values of the wrong type, each at its own key. Errors name fields with
+// prefix, and the section they are in.
+//
+// Unexpected fields are passed to unexpected, if set, and are only reported
+// if it returns false. Fields that hold a struct, like a session's ready,
+// are decoded the same way.
+func decodeTable(raw interface{}, v reflect.Value, key, section, prefix string, unexpected func(name string, value interface{}) bool) error {
+	table, ok := raw.(map[string]interface{})
+	if !ok {
+		return atKey(key, fmt.Errorf("%s must be a table", key))
+	}
+	fields := configFields(v.Type())
+	var errs error
+	for _, name := range slices.Sorted(maps.Keys(table)) {
+		value := table[name]
+		fieldKey := joinKey(key, name)
+		field, ok := fields[strings.ToLower(name)]
+		if !ok {
+			if unexpected != nil && unexpected(name, value) {
+				continue
+			}
+			msg := fmt.Sprintf("unexpected field %q", prefix+name)
+			if section != "" {
+				msg += " in " + section
+			}
+			errs = multierror.Append(errs, atKey(fieldKey, errors.New(msg)))
+			continue
+		}
+
+		if t := field.Type; t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct {
+			if nested, ok := value.(map[string]interface{}); ok {
+				result := reflect.New(t.Elem())
+				if err := decodeTable(nested, result.Elem(), fieldKey, section, prefix+name+".", nil); err != nil {
+					errs = multierror.Append(errs, err)
+					continue
+				}
+				v.FieldByIndex(field.Index).Set(result)
+				continue
+			}
+		}
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			DecodeHook: durationHook(),
+			Result:     v.FieldByIndex(field.Index).Addr().Interface(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := decoder.Decode(value); err != nil {
+			msg := fmt.Sprintf("%s must be %s", fieldKey, describeType(field.Type))
+			var unit unitError
+			if errors.As(err, &unit) {
+				msg += ": " + unit.Error()
+			}
+			errs = multierror.Append(errs, atKey(fieldKey, errors.New(msg)))
+		}
+	}
+	return errs
+}
+
+// configFields returns the fields of a config struct by their lowercase
+// key, the way mapstructure matches them.
+func configFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for _, field := range reflect.VisibleFields(t) {
+		name := field.Tag.Get("mapstructure")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field
+	}
+	return fields
+}
+
+// describeType describes the values a field of type t accepts.
+func describeType(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return `a duration, like "500ms" or "2m"`
+	case t.Kind() == reflect.String:
+		return "a string"
+	case t.Kind() == reflect.Bool:
+		return "true or false"
+	case t.Kind() == reflect.Int:
+		return "an integer"
+	case t.Kind() == reflect.Float64:
+		return "a number"
+	case t.Kind() == reflect.Slice:
+		return "a list of " + strings.TrimPrefix(strings.TrimPrefix(describeType(t.Elem()), "a "), "an ") + "s"
+	case t.Kind() == reflect.Map && t.Elem().Kind() == reflect.String:
+		return "a table of strings"
+	case t.Kind() == reflect.Map, t.Kind() == reflect.Pointer:
+		return "a table"
+	}
+	return t.String()
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
 func validateConfig(cfg Config) error {
 	return cfg.Validate()
 }
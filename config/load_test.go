@@ -4,12 +4,17 @@ import (
 	"embed"
 	_ "embed"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
-//go:embed data/*.toml
+//go:embed data/*.toml data/*.yaml data/*.json
 var dataFS embed.FS
 
 func TestLoadConfig(t *testing.T) {
@@ -48,10 +53,205 @@ func TestLoadConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "on-failure",
+			expOutput: &Config{
+				Sessions: map[string]*Session{
+					"setup": {
+						Name:      "setup",
+						Script:    "echo 'Setup is done'\n",
+						OnFailure: OnFailureRetry,
+						Retries:   3,
+					},
+					"server": {
+						Name:      "server",
+						DependsOn: []string{"sessions.setup"},
+						Script:    "echo 'Server is ready'\n",
+						OnFailure: OnFailureContinue,
+					},
+				},
+			},
+		},
+		{
+			name:     "on-failure-invalid",
+			expError: `in session "setup": on_failure must be one of "stop", "continue" or "retry", got "ignore"`,
+		},
+		{
+			name:     "retries-without-retry",
+			expError: `in session "setup": retries requires on_failure = "retry"`,
+		},
+		{
+			name: "ready",
+			expOutput: &Config{
+				Sessions: map[string]*Session{
+					"server": {
+						Name:   "server",
+						Inject: "python3 -m http.server 8080\n",
+						Ready: &Ready{
+							TCP:      "localhost:8080",
+							HTTP:     "http://localhost:8080/",
+							Status:   200,
+							Match:    "Serving HTTP on .* port 8080",
+							Interval: 500 * time.Millisecond,
+							Timeout:  2 * time.Minute,
+						},
+					},
+					"client": {
+						Name:      "client",
+						DependsOn: []string{"sessions.server"},
+						Inject:    "curl localhost:8080\n",
+					},
+				},
+			},
+		},
+		{
+			name:     "ready-empty",
+			expError: `in session "server": ready needs at least one of tcp, http, file, match or command`,
+		},
+		{
+			name:     "ready-bad-match",
+			expError: `in session "server": ready.match: error parsing regexp`,
+		},
+		{
+			name:     "ready-bare-duration",
+			expError: `30 has no unit, write a duration like "30s"`,
+		},
+		{
+			name:     "ready-unknown-field",
+			expError: `unexpected field "ready.wumbo" in sessions.server`,
+		},
+		{
+			name: "depends-on-unprefixed",
+			expOutput: &Config{
+				Sessions: map[string]*Session{
+					"setup": {
+						Name:   "setup",
+						Script: "echo 'Setup is done'\n",
+					},
+					"server": {
+						Name:      "server",
+						DependsOn: []string{"setup"},
+						Inject:    "echo 'This is where the server would start'\n",
+					},
+				},
+			},
+		},
+		{
+			name:     "depends-on-unknown",
+			expError: `in session "server": depends_on "setpu": no such session (did you mean "setup"?)`,
+		},
+		{
+			name:     "depends-on-cycle",
+			expError: `dependency cycle: server -> setup -> worker.2 -> worker.1 -> server`,
+		},
+		{
+			name:     "depends-on-self",
+			expError: `dependency cycle: setup -> setup`,
+		},
+		{
+			name:     "env-invalid-name",
+			expError: `in session "server": invalid environment variable name "MY-PORT"`,
+		},
+		{
+			name: "vars",
+			expOutput: &Config{
+				Vars: map[string]any{"port": int64(8080), "host": "localhost"},
+				Sessions: map[string]*Session{
+					"server": {
+						Name:   "server",
+						Env:    map[string]string{"URL": "http://localhost:8080"},
+						Inject: "serve --port 8080 --name server\n",
+					},
+					"worker.1": {
+						Name:   "worker.1",
+						Script: "echo 'worker worker.1 on localhost'\necho '{{ not a template }}'\n",
+					},
+				},
+			},
+		},
+		{
+			name:     "vars-unknown",
+			expError: `in session "server": template: inject:1:21: executing "inject" at <.Vars.prot>: map has no entry for key "prot"`,
+		},
+		{
+			name:     "vars-syntax",
+			expError: `in session "server": template: script:2: unclosed action started at script:1`,
+		},
+		{
+			name: "layout",
+			expOutput: &Config{
+				Layout: &Layout{Rows: []*Layout{
+					{Size: 3, Columns: []*Layout{{Session: "editor", Size: 2}, {Session: "sessions.server"}}},
+					{Session: "shell"},
+				}},
+				Sessions: map[string]*Session{
+					"editor": {Name: "editor", Inject: "vim"},
+					"server": {Name: "server", Inject: "make serve"},
+					"shell":  {Name: "shell", Inject: "git status"},
+				},
+			},
+		},
+		{
+			name:     "layout-missing",
+			expError: `layout: missing sessions "server", "shell"`,
+		},
+		{
+			name:     "layout-unknown-session",
+			expError: `layout: no such session "sever" (did you mean "server"?)`,
+		},
+		{
+			name:     "layout-bad-entry",
+			expError: `layout: each entry needs exactly one of session, rows or columns`,
+		},
+		{
+			name:     "layout-unknown-field",
+			expError: `unexpected field "wumbo" in layout.columns[0]`,
+		},
+		{
+			name:     "layout-bad-size",
+			expError: `layout.rows[0].size must be a number`,
+		},
+		{
+			name: "tabs",
+			expOutput: &Config{
+				Tabs: map[string]*Tab{
+					"db": {Title: "Databases", Window: "data", Layout: &Layout{Columns: []*Layout{
+						{Session: "postgres", Size: 2},
+						{Session: "redis"},
+					}}},
+				},
+				Sessions: map[string]*Session{
+					"server":   {Name: "server", Inject: "make serve"},
+					"logs":     {Name: "logs", Tab: "logs", Inject: "tail -f server.log"},
+					"postgres": {Name: "postgres", Tab: "db", Window: "data", Inject: "postgres"},
+					"redis":    {Name: "redis", Tab: "db", Window: "data", Inject: "redis-server"},
+				},
+			},
+		},
+		{
+			name:     "tabs-window-conflict",
+			expError: `in session "redis": window "cache": tab "db" is in window "data", with session "postgres"`,
+		},
+		{
+			name:     "tabs-layout-other-tab",
+			expError: `layout: session "postgres" is in another tab`,
+		},
+		{
+			name:     "tabs-unknown-field",
+			expError: `unexpected field "wumbo" in tabs.db.layout.rows[0]`,
+		},
+		{
+			name:     "tabs-unknown-field-tab",
+			expError: `unexpected field "titel" in tabs.db`,
+		},
 		{
 			name:     "unknown-field",
 			expError: `unexpected field "wumbo" in sessions.setup`,
 		},
+		{
+			name:     "unknown-field-top-level",
+			expError: `unexpected field "diretcory"`,
+		},
 		{
 			name:     "empty-session",
 			expError: `empty session config section sessions.empty`,
@@ -93,3 +293,151 @@ func TestLoadConfig(t *testing.T) {
 	}
 
 }
+
+// TestLoadConfigFormats checks that YAML and JSON configs load the same way
+// as the TestLoadConfig cases they mirror.
+func TestLoadConfigFormats(t *testing.T) {
+	for _, name := range []string{
+		"success.yaml",
+		"success.json",
+		"vars.yaml",
+		"vars.json",
+		"unknown-field-nested.yaml",
+		"unknown-field-nested.json",
+		"empty-session-nested.yaml",
+		"empty-session-nested.json",
+	} {
+		t.Run(name, func(t *testing.T) {
+			load := func(fname string) (*Config, error) {
+				f, err := dataFS.Open(fname)
+				require.NoError(t, err, fmt.Sprintf("missing test data file: config/%s (%s)", fname, err))
+				return loadConfigFile(f)
+			}
+			ext := filepath.Ext(name)
+			expOutput, expErr := load("data/TestLoadConfig_" + strings.TrimSuffix(name, ext) + ".toml")
+
+			cfg, err := load("data/TestLoadConfig_" + name)
+
+			if expErr != nil {
+				require.EqualError(t, err, expErr.Error())
+				require.Nil(t, cfg)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, expOutput, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Setenv("TEST_LOAD_ENV_HOME", "/opt")
+
+	cfg, err := LoadConfig("data/TestLoadConfigEnv.toml")
+	require.NoError(t, err)
+
+	shared := map[string]string{
+		"NAME":      "world",
+		"PORT":      "8080",
+		"QUOTED":    "a \"quoted\"\tvalue",
+		"LITERAL":   "${NAME} stays",
+		"URL":       "http://localhost:8080/",
+		"GREETING":  "hello world",
+		"TOOL_HOME": "/opt/tool",
+	}
+	require.Equal(t, shared, cfg.Sessions["client"].Environment())
+
+	// The session's env_file and env override the top-level ones, but the
+	// top-level env was expanded with the top-level values.
+	server := maps.Clone(shared)
+	server["NAME"] = "server"
+	server["PORT"] = "9090"
+	require.Equal(t, server, cfg.Sessions["server"].Environment())
+}
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expError string
+	}{
+		{name: "missing-equals", in: "NAME\n", expError: "line 1: expected NAME=value"},
+		{name: "bad-name", in: "# comment\n1NAME=x\n", expError: "line 2: expected NAME=value"},
+		{name: "unterminated-single", in: "NAME='x\n", expError: "line 1: unterminated single quote"},
+		{name: "unterminated-double", in: "NAME=\"x\n", expError: "line 1: unterminated double quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseEnvFile(strings.NewReader(tt.in), map[string]string{})
+			require.EqualError(t, err, tt.expError)
+		})
+	}
+}
+
+func TestLoadConfigDirectory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.Mkdir(filepath.Join(home, "my project"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(home, "sub"), 0o755))
+
+	cfg, err := LoadConfig("data/TestLoadConfigDirectory.toml")
+	require.NoError(t, err)
+
+	data, err := filepath.Abs("data")
+	require.NoError(t, err)
+	require.Equal(t, data, cfg.BaseDir)
+	require.Equal(t, data, cfg.Sessions["default"].WorkDir())
+	require.Equal(t, filepath.Dir(data), cfg.Sessions["parent"].WorkDir())
+	require.Equal(t, filepath.Join(home, "my project"), cfg.Sessions["home"].WorkDir())
+	require.Equal(t, filepath.Join(home, "sub"), cfg.Sessions["env"].WorkDir())
+
+	_, err = LoadConfig("data/TestLoadConfigDirectory-missing.toml")
+	require.ErrorContains(t, err, `in session "server": directory "does-not-exist": stat `)
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	cfg, err := LoadConfig("data/TestLoadConfigInclude.toml", "data/TestLoadConfigInclude-local.toml")
+	require.NoError(t, err)
+
+	require.Equal(t, "test-load-include", cfg.ID)
+	require.Equal(t, map[string]string{"LOG_LEVEL": "debug", "REGION": "us"}, cfg.Env)
+	require.Len(t, cfg.Sessions, 3)
+	require.NotContains(t, cfg.Sessions, "docs")
+	require.Equal(t, "make setup", cfg.Sessions["setup"].Script)
+	require.Equal(t, "make serve-debug", cfg.Sessions["server"].Inject)
+	require.Empty(t, cfg.Sessions["server"].DependsOn)
+	require.Equal(t, []string{"setup", "server"}, cfg.Sessions["worker.1"].DependsOn)
+	require.Equal(t, "make worker", cfg.Sessions["worker.1"].Inject)
+
+	// Includes are relative to the including file, not the working directory.
+	data, err := filepath.Abs("data")
+	require.NoError(t, err)
+	t.Chdir(t.TempDir())
+	_, err = LoadConfig(filepath.Join(data, "TestLoadConfigInclude.toml"))
+	require.NoError(t, err)
+}
+
+func TestLoadConfigIncludeDirs(t *testing.T) {
+	cfg, err := LoadConfig("data/TestLoadConfigIncludeDirs.toml")
+	require.NoError(t, err)
+
+	// Paths are relative to the file that sets them, even once appended to
+	// or inherited by another file.
+	data, err := filepath.Abs("data")
+	require.NoError(t, err)
+	shared := filepath.Join(data, "TestLoadConfigIncludeDirs")
+	require.Equal(t, data, cfg.Sessions["client"].WorkDir())
+	require.Equal(t, shared, cfg.Sessions["server"].WorkDir())
+	require.Equal(t, data, cfg.Sessions["worker.1"].WorkDir())
+
+	require.Equal(t, "yes", cfg.Sessions["client"].Environment()["SHARED"])
+	require.Equal(t, "world", cfg.Sessions["client"].Environment()["NAME"])
+	require.NotContains(t, cfg.Sessions["client"].Environment(), "SERVER")
+	require.Equal(t, "yes", cfg.Sessions["server"].Environment()["SERVER"])
+	require.Equal(t, "yes", cfg.Sessions["worker.1"].Environment()["SERVER"])
+}
+
+func TestLoadConfigIncludeCycle(t *testing.T) {
+	_, err := LoadConfig("data/TestLoadConfigInclude-cycle.toml")
+	data, _ := filepath.Abs("data")
+	require.ErrorContains(t, err, fmt.Sprintf("include cycle: %[1]s/TestLoadConfigInclude-cycle.toml -> %[1]s/TestLoadConfigInclude-cycle-2.toml -> %[1]s/TestLoadConfigInclude-cycle.toml", data))
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a place in a config file. Line and Column start at 1, and are
+// 0 when unknown.
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+func (p Position) String() string {
+	switch {
+	case p.Line == 0:
+		return p.File
+	case p.Column == 0:
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// positions maps dotted keys, like "sessions.server.inject", to where they
+// are set. Like values, keys set by later files override earlier ones.
+type positions map[string]Position
+
+// lookup returns the position of key, or of the nearest enclosing key that
+// has one.
+func (p positions) lookup(key string) (Position, bool) {
+	for key != "" {
+		if pos, ok := p[key]; ok {
+			return pos, true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return Position{}, false
+}
+
+// indexPositions finds the position of every key in a config file. It
+// returns what it found so far if the file has a syntax error, which
+// decodeRaw reports.
+func indexPositions(path string, data []byte) positions {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		// JSON is YAML, as far as positions are concerned.
+		return indexYAML(path, data)
+	}
+	return indexTOML(path, data)
+}
+
+func indexTOML(path string, data []byte) positions {
+	index := positions{}
+	var p unstable.Parser
+	p.Reset(data)
+
+	// add records the position of each prefix of the dotted key it, below
+	// table. The first definition of a key in the file wins.
+	add := func(table []string, it unstable.Iterator) []string {
+		key := table
+		for it.Next() {
+			// An appended list, like "depends_on+", is at the list's key.
+			key = append(key[:len(key):len(key)], strings.TrimSuffix(string(it.Node().Data), "+"))
+			name := strings.Join(key, ".")
+			if _, ok := index[name]; !ok {
+				shape := p.Shape(it.Node().Raw)
+				index[name] = Position{File: path, Line: shape.Start.Line, Column: shape.Start.Column}
+			}
+		}
+		return key
+	}
+	var addKeyValue func(table []string, n *unstable.Node)
+	addKeyValue = func(table []string, n *unstable.Node) {
+		key := add(table, n.Key())
+		if value := n.Value(); value.Kind == unstable.InlineTable {
+			it := value.Children()
+			for it.Next() {
+				addKeyValue(key, it.Node())
+			}
+		}
+	}
+
+	var table []string
+	for p.NextExpression() {
+		n := p.Expression()
+		switch n.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = add(nil, n.Key())
+		case unstable.KeyValue:
+			addKeyValue(table, n)
+		}
+	}
+	return index
+}
+
+func indexYAML(path string, data []byte) positions {
+	index := positions{}
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+			walk(prefix, n.Content[0])
+			return
+		}
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			name := prefix + strings.TrimSuffix(key.Value, "+")
+			index[name] = Position{File: path, Line: key.Line, Column: key.Column}
+			walk(name+".", value)
+		}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err == nil {
+		walk("", &doc)
+	}
+	return index
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// syntaxError returns err, from decoding the file at path, with the position
+// of the error if the decoder reports one.
+func syntaxError(path string, data []byte, err error) error {
+	pos := Position{File: path}
+	var tomlErr *toml.DecodeError
+	var jsonSyntaxErr *json.SyntaxError
+	var jsonTypeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tomlErr):
+		pos.Line, pos.Column = tomlErr.Position()
+	case errors.As(err, &jsonSyntaxErr):
+		pos.Line, pos.Column = offsetPosition(data, jsonSyntaxErr.Offset)
+	case errors.As(err, &jsonTypeErr):
+		pos.Line, pos.Column = offsetPosition(data, jsonTypeErr.Offset)
+	default:
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			pos.Line, _ = strconv.Atoi(m[1])
+			err = errors.New(m[2])
+		}
+	}
+	return &posError{pos: pos, err: err}
+}
+
+// offsetPosition converts a byte offset in data to a line and column.
+func offsetPosition(data []byte, offset int64) (line, column int) {
+	lead := data[:min(int(offset), len(data))]
+	return bytes.Count(lead, []byte{'\n'}) + 1, len(lead) - bytes.LastIndexByte(lead, '\n')
+}
+
+// posError is an error at a position in a config file.
+type posError struct {
+	pos Position
+	err error
+}
+
+func (e *posError) Error() string {
+	return fmt.Sprintf("%s: %v", e.pos, e.err)
+}
+
+func (e *posError) Unwrap() error {
+	return e.err
+}
+
+// keyError is an error about the value at a key of the config, like
+// "sessions.server.on_failure". The key lets Check find where the value is
+// set; the message is unchanged.
+type keyError struct {
+	key string
+	err error
+}
+
+func (e *keyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *keyError) Unwrap() error {
+	return e.err
+}
+
+func atKey(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &keyError{key: key, err: err}
+}
+
+// sessionKey returns the key of a session's field, or of the session itself
+// if field is "".
+func sessionKey(name, field string) string {
+	if field == "" {
+		return "sessions." + name
+	}
+	return "sessions." + name + "." + field
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaDescriptions documents each field in the schema, by the name of its
+// definition and its key.
+var schemaDescriptions = map[string]string{
+	"config.id":        "A unique id for this project. At most one window runs per id at a time.",
+	"config.directory": "The working directory of all sessions. Relative to the config file; ~ and ${VAR} are expanded.",
+	"config.backend":   "The terminal to run sessions in.",
+	"config.vars":      "Values that templates in the config can refer to, as {{ .Vars.name }}.",
+	"config.env":       "Environment variables for all sessions.",
+	"config.env_file":  "Dotenv files with environment variables for all sessions, relative to the config file.",
+	"config.include":   "Config files to merge this file over, relative to this file.",
+	"config.sessions": "The sessions to start, by name. A table inside a session is another session in the same " +
+		"group: sessions.worker.1 is the session \"worker.1\" in the group \"worker\".",
+
+	"session.directory":  "The working directory of the session. Defaults to the top-level directory.",
+	"session.depends_on": "Sessions that must be done (or ready) before this one starts, with or without the \"sessions.\" prefix.",
+	"session.script":     "A script to run in the session. The tool waits for it to complete.",
+	"session.inject":     "Commands typed into the session, after the script. The tool does not wait for them.",
+	"session.on_failure": "What to do when the script exits with a non-zero status. Defaults to \"stop\".",
+	"session.retries":    "How many times to rerun a failed script, with on_failure = \"retry\". Defaults to 1.",
+	"session.ready":      "How to tell that the session is ready for the sessions that depend on it.",
+	"session.env":        "Environment variables for this session. They override the top-level ones.",
+	"session.env_file":   "Dotenv files with environment variables for this session, relative to the config file.",
+	"session.disabled":   "Removes the session, and dependencies on it.",
+	"session.tab":        "The tab the session runs in. Defaults to the first tab of its window.",
+	"session.window":     "The window the session runs in. Defaults to the window of its tab, or else the main window.",
+
+	"config.layout": "How to arrange the sessions in the first tab of the main window. Defaults to a column per group, " +
+		"with the sessions of a group in rows.",
+
+	"config.tabs": "Settings for the tabs that sessions name in their tab field.",
+
+	"tab.title":  "The title of the tab. Defaults to the tab's name.",
+	"tab.window": "The window the tab is in, unless its sessions set their own. Defaults to the main window.",
+	"tab.layout": "How to arrange the sessions of the tab. Defaults to a column per group, with the sessions of a group in rows.",
+
+	"layout.session": "The session in this pane, with or without the \"sessions.\" prefix.",
+	"layout.size":    "The share of the parent's space, relative to the entries next to this one. Defaults to 1.",
+	"layout.rows":    "Entries stacked top to bottom.",
+	"layout.columns": "Entries side by side.",
+
+	"ready.tcp":      "A host:port that accepts connections.",
+	"ready.http":     "A URL that answers a GET with the expected status.",
+	"ready.status":   "The expected HTTP status. Defaults to any 2xx status.",
+	"ready.file":     "A path that exists, relative to the session's directory.",
+	"ready.match":    "A regular expression that matches the session's output.",
+	"ready.command":  "A shell command that exits with status zero.",
+	"ready.interval": "The time between checks. Defaults to 1s.",
+	"ready.timeout":  "How long to wait for all checks to pass. Defaults to 60s.",
+}
+
+// Schema returns a JSON Schema for config files. It describes the fields
+// LoadConfig accepts, for editors to complete and check configs with.
+func Schema() map[string]any {
+	config := schemaObject("config", reflect.TypeOf(Config{}))
+	props := config["properties"].(map[string]any)
+	props["include"] = describe("config.include", map[string]any{
+		"type":  "array",
+		"items": map[string]any{"type": "string"},
+	})
+	props["sessions"] = describe("config.sessions", map[string]any{
+		"type":                 "object",
+		"minProperties":        1,
+		"additionalProperties": map[string]any{"$ref": "#/$defs/session"},
+	})
+	config["required"] = []string{"id", "sessions"}
+
+	// A key ending in "+" appends to an included list.
+	appended := map[string]any{`\+$`: map[string]any{"type": "array"}}
+	config["patternProperties"] = appended
+
+	session := schemaObject("session", reflect.TypeOf(Session{}))
+	session["additionalProperties"] = map[string]any{"$ref": "#/$defs/session"}
+	session["patternProperties"] = appended
+
+	// An entry holds a session, rows or columns.
+	layout := schemaObject("layout", reflect.TypeOf(Layout{}))
+	layout["oneOf"] = []any{
+		map[string]any{"required": []string{"session"}},
+		map[string]any{"required": []string{"rows"}},
+		map[string]any{"required": []string{"columns"}},
+	}
+
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "iterm-tool config",
+		"$defs": map[string]any{
+			"session": session,
+			"ready":   schemaObject("ready", reflect.TypeOf(Ready{})),
+			"layout":  layout,
+			"tab":     schemaObject("tab", reflect.TypeOf(Tab{})),
+		},
+	}
+	for key, value := range config {
+		schema[key] = value
+	}
+	return schema
+}
+
+// schemaObject returns the schema of a config struct, named def in
+// schemaDescriptions.
+func schemaObject(def string, t reflect.Type) map[string]any {
+	props := map[string]any{}
+	for name, field := range configFields(t) {
+		if name == "sessions" || (def == "session" && name == "name") {
+			continue
+		}
+		props[name] = describe(def+"."+name, schemaType(def+"."+name, field))
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// durationPattern matches the durations time.ParseDuration accepts.
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+func schemaType(key string, field reflect.StructField) map[string]any {
+	switch key {
+	case "config.backend":
+		_, values, _ := strings.Cut(field.Tag.Get("validate"), "oneof=")
+		return map[string]any{"type": "string", "enum": strings.Fields(values)}
+	case "session.on_failure":
+		return map[string]any{"type": "string", "enum": []string{OnFailureStop, OnFailureContinue, OnFailureRetry}}
+	case "session.depends_on":
+		return map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string", "pattern": `^(sessions\.)?[^.]+(\.[^.]+)*$`},
+		}
+	case "session.retries":
+		return map[string]any{"type": "integer", "minimum": 0}
+	case "layout.size":
+		return map[string]any{"type": "number", "exclusiveMinimum": 0}
+	case "ready.status":
+		return map[string]any{"type": "integer", "minimum": 100, "maximum": 599}
+	case "config.env", "session.env":
+		return map[string]any{
+			"type":                 "object",
+			"propertyNames":        map[string]any{"pattern": envNameRe.String()},
+			"additionalProperties": map[string]any{"type": "string"},
+		}
+	}
+
+	t := field.Type
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	case t == reflect.TypeOf(&Ready{}):
+		return map[string]any{"$ref": "#/$defs/ready"}
+	case t == reflect.TypeOf(&Layout{}):
+		return map[string]any{"$ref": "#/$defs/layout"}
+	case t == reflect.TypeOf(map[string]*Tab{}):
+		return map[string]any{"type": "object", "additionalProperties": map[string]any{"$ref": "#/$defs/tab"}}
+	case t == reflect.TypeOf([]*Layout{}):
+		return map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/layout"}}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() == reflect.Int:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		return map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+	case t.Kind() == reflect.Map && t.Elem().Kind() == reflect.String:
+		return map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object"}
+	}
+	panic(fmt.Sprintf("no schema for %s of type %s", key, t))
+}
+
+func describe(key string, schema map[string]any) map[string]any {
+	if description, ok := schemaDescriptions[key]; ok {
+		schema["description"] = description
+	}
+	return schema
+}
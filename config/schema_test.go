@@ -0,0 +1,26 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	_, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	// Every field is documented.
+	defs := schema["$defs"].(map[string]any)
+	for def, obj := range map[string]map[string]any{"config": schema, "session": defs["session"].(map[string]any), "ready": defs["ready"].(map[string]any), "layout": defs["layout"].(map[string]any), "tab": defs["tab"].(map[string]any)} {
+		for name, prop := range obj["properties"].(map[string]any) {
+			require.Contains(t, prop, "description", "%s.%s", def, name)
+		}
+	}
+
+	props := schema["properties"].(map[string]any)
+	require.Equal(t, []string{"iterm2", "tmux", "pty"}, props["backend"].(map[string]any)["enum"])
+	require.NotContains(t, defs["session"].(map[string]any)["properties"], "name")
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Tab configures a tab that sessions run in, by naming it in their tab
+// field.
+type Tab struct {
+	// Title is the title of the tab. Defaults to the tab's name.
+	Title string
+	// Window is the window the tab is in, unless its sessions set their own.
+	// Defaults to the main window.
+	Window string
+	// Layout arranges the sessions of the tab. See LayoutTree for the
+	// default.
+	Layout *Layout
+}
+
+// Place is where a session runs: a tab of a window, by name. The zero Place
+// is the first tab of the main window.
+type Place struct {
+	Window string
+	Tab    string
+}
+
+// Place returns where the session runs.
+func (s Session) Place() Place {
+	return Place{Window: s.Window, Tab: s.Tab}
+}
+
+// Places returns the places that have sessions, sorted by window and then
+// by tab. The first tab of each window comes before the other tabs in it.
+func (c Config) Places() []Place {
+	seen := map[Place]bool{}
+	var places []Place
+	for _, s := range c.Sessions {
+		if p := s.Place(); !seen[p] {
+			seen[p] = true
+			places = append(places, p)
+		}
+	}
+	sort.Slice(places, func(i, j int) bool {
+		if places[i].Window != places[j].Window {
+			return places[i].Window < places[j].Window
+		}
+		return places[i].Tab < places[j].Tab
+	})
+	return places
+}
+
+// SessionsAt returns the sessions that run at p, by name.
+func (c Config) SessionsAt(p Place) map[string]*Session {
+	result := map[string]*Session{}
+	for name, s := range c.Sessions {
+		if s.Place() == p {
+			result[name] = s
+		}
+	}
+	return result
+}
+
+// WindowTitle returns the title of a window: the config's id, followed by
+// the window's name for windows other than the main one.
+func (c Config) WindowTitle(window string) string {
+	if window == "" {
+		return c.ID
+	}
+	return c.ID + "/" + window
+}
+
+// TabTitle returns the title of the tab at p, or "" to leave the title the
+// terminal gives it.
+func (c Config) TabTitle(p Place) string {
+	if tab, ok := c.Tabs[p.Tab]; ok && tab.Title != "" {
+		return tab.Title
+	}
+	return p.Tab
+}
+
+// TabLayout returns the layout configured for the tab at p, if any. The
+// top-level layout is for the first tab of the main window.
+func (c Config) TabLayout(p Place) *Layout {
+	if p == (Place{}) {
+		return c.Layout
+	}
+	if tab, ok := c.Tabs[p.Tab]; ok && p.Tab != "" {
+		return tab.Layout
+	}
+	return nil
+}
+
+// decodeTabs decodes the tabs section, with decodeLayout for their layouts.
+// It reports the problems of every tab.
+func decodeTabs(raw interface{}) (map[string]*Tab, error) {
+	rawTabs, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, atKey("tabs", fmt.Errorf("tabs must be a table, got %v", raw))
+	}
+	var errs error
+	tabs := map[string]*Tab{}
+	for _, name := range slices.Sorted(maps.Keys(rawTabs)) {
+		key := "tabs." + name
+		rawTab, ok := rawTabs[name].(map[string]interface{})
+		if !ok {
+			errs = multierror.Append(errs, atKey(key, fmt.Errorf("%s must be a table, got %v", key, rawTabs[name])))
+			continue
+		}
+		var tab Tab
+		rest := map[string]interface{}{}
+		for field, value := range rawTab {
+			if field != "layout" {
+				rest[field] = value
+			}
+		}
+		if err := decodeStrict(key, rest, &tab); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if rawLayout, ok := rawTab["layout"]; ok {
+			l, err := decodeLayout(key+".layout", rawLayout)
+			if err != nil {
+				errs = multierror.Append(errs, err)
+			}
+			tab.Layout = l
+		}
+		tabs[name] = &tab
+	}
+	return tabs, errs
+}
+
+// resolveWindows puts sessions that do not name a window in the window of
+// their tab.
+func (c *Config) resolveWindows() {
+	for _, s := range c.Sessions {
+		if tab, ok := c.Tabs[s.Tab]; ok && s.Window == "" {
+			s.Window = tab.Window
+		}
+	}
+}
+
+// validateTabs checks that each named tab is in one window, and that the
+// tab layouts hold the sessions of their tab.
+func (c Config) validateTabs() error {
+	var errs error
+	windows := map[string]string{}
+	tabOwners := map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(c.Sessions)) {
+		s := c.Sessions[name]
+		if s.Tab == "" {
+			continue
+		}
+		if owner, ok := tabOwners[s.Tab]; ok && windows[s.Tab] != s.Window {
+			errs = multierror.Append(errs, atKey(sessionKey(name, "window"), fmt.Errorf(
+				"in session %q: window %q: tab %q is in window %q, with session %q",
+				name, s.Window, s.Tab, windows[s.Tab], owner)))
+			continue
+		}
+		windows[s.Tab], tabOwners[s.Tab] = s.Window, name
+	}
+	if errs != nil {
+		return errs
+	}
+
+	if err := c.validateLayout("layout", c.Layout, Place{}); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Tabs)) {
+		if name == "" {
+			errs = multierror.Append(errs, atKey("tabs", errors.New("tabs: a tab needs a name")))
+			continue
+		}
+		place := Place{Window: c.Tabs[name].Window, Tab: name}
+		if owner, ok := tabOwners[name]; ok {
+			place.Window = c.Sessions[owner].Window
+		}
+		if err := c.validateLayout("tabs."+name+".layout", c.Tabs[name].Layout, place); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pglass/iterm-tool/layout"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaces(t *testing.T) {
+	f, err := dataFS.Open("data/TestLoadConfig_tabs.toml")
+	require.NoError(t, err)
+	cfg, err := loadConfigFile(f)
+	require.NoError(t, err)
+
+	// The first tab of each window comes first.
+	places := cfg.Places()
+	require.Equal(t, []Place{{}, {Tab: "logs"}, {Window: "data", Tab: "db"}}, places)
+
+	require.Equal(t, "test-load-tabs", cfg.WindowTitle(""))
+	require.Equal(t, "test-load-tabs/data", cfg.WindowTitle("data"))
+	require.Equal(t, "", cfg.TabTitle(Place{}))
+	require.Equal(t, "logs", cfg.TabTitle(Place{Tab: "logs"}))
+	require.Equal(t, "Databases", cfg.TabTitle(Place{Window: "data", Tab: "db"}))
+
+	require.Equal(t, layout.Leaf("server"), cfg.LayoutTree(Place{}))
+	require.Equal(t, layout.Leaf("logs"), cfg.LayoutTree(Place{Tab: "logs"}))
+	require.Equal(t, &layout.Node{Columns: true, Children: []*layout.Node{
+		{Session: "postgres", Size: 2},
+		layout.Leaf("redis"),
+	}}, cfg.LayoutTree(Place{Window: "data", Tab: "db"}))
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// templateData is what templates in the config can refer to.
+type templateData struct {
+	// ID is the config id.
+	ID string
+	// Vars is the top-level vars table.
+	Vars map[string]any
+	// Env is the environment the tool runs in.
+	Env map[string]string
+	// Session is the session being rendered. It is empty when rendering
+	// top-level fields.
+	Session struct {
+		Name  string
+		Group string
+	}
+}
+
+// render expands the templates in the top-level directory and env, and in
+// each session's script, inject, directory and env.
+func (c *Config) render() error {
+	data := templateData{
+		ID:   c.ID,
+		Vars: c.Vars,
+		Env:  map[string]string{},
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		data.Env[name] = value
+	}
+
+	errs := multierror.Append(nil,
+		atKey("directory", renderString("directory", &c.Directory, data)),
+		atKey("env", renderEnv(c.Env, data)),
+	)
+	for _, s := range c.Sessions {
+		data := data
+		data.Session.Name = s.Name
+		data.Session.Group = s.Group()
+		err := errors.Join(
+			renderString("script", &s.Script, data),
+			renderString("inject", &s.Inject, data),
+			renderString("directory", &s.Directory, data),
+			renderEnv(s.Env, data),
+		)
+		if err != nil {
+			errs = multierror.Append(errs, atKey(sessionKey(s.Name, ""), fmt.Errorf("in session %q: %w", s.Name, err)))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// renderString renders the template in *text in place. The name shows up in errors.
+func renderString(name string, text *string, data templateData) error {
+	if !strings.Contains(*text, "{{") {
+		return nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(*text)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return err
+	}
+	*text = b.String()
+	return nil
+}
+
+func renderEnv(env map[string]string, data templateData) error {
+	for name, value := range env {
+		if err := renderString("env."+name, &value, data); err != nil {
+			return err
+		}
+		env[name] = value
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package dag checks that names depending on each other, like sessions or
+// tasks, form a directed acyclic graph.
+package dag
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CycleError reports a dependency cycle.
+type CycleError struct {
+	// Cycle lists the names in the cycle, starting and ending with the same
+	// name.
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// FindCycle returns a *CycleError if the names depend on each other in a
+// cycle. deps returns the dependencies of a name, which must all be in names.
+// names and dependencies are searched in order, which decides the cycle
+// reported when there are several.
+func FindCycle(names []string, deps func(name string) []string) error {
+	// Depth-first search, remembering the path to report the cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			cycle := append(slices.Clone(path[slices.Index(path, name):]), name)
+			return &CycleError{Cycle: cycle}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps(name) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
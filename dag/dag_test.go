@@ -0,0 +1,49 @@
+package dag
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		deps     map[string][]string
+		expCycle []string
+	}{
+		{
+			name: "none",
+			deps: map[string][]string{"a": nil, "b": {"a"}, "c": {"a", "b"}},
+		},
+		{
+			name:     "self",
+			deps:     map[string][]string{"a": {"a"}},
+			expCycle: []string{"a", "a"},
+		},
+		{
+			name:     "behind other tasks",
+			deps:     map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"c"}},
+			expCycle: []string{"c", "d", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for name := range tt.deps {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+
+			err := FindCycle(names, func(name string) []string { return tt.deps[name] })
+			if tt.expCycle == nil {
+				require.NoError(t, err)
+				return
+			}
+			var cycle *CycleError
+			require.ErrorAs(t, err, &cycle)
+			require.Equal(t, tt.expCycle, cycle.Cycle)
+		})
+	}
+}
@@ -1,9 +1,10 @@
 module github.com/pglass/iterm-tool
 
-go 1.22.3
+go 1.24.0
 
 require (
 	github.com/andybrewer/mack v0.0.0-20220307193339-22e922cc18af
+	github.com/creack/pty v1.1.21
 	github.com/go-playground/validator/v10 v10.21.0
 	github.com/go-viper/mapstructure/v2 v2.1.0
 	github.com/gorilla/websocket v1.5.1
@@ -13,6 +14,7 @@ require (
 	github.com/urfave/cli/v2 v2.27.2
 	golang.org/x/sync v0.7.0
 	google.golang.org/protobuf v1.34.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -30,5 +32,4 @@ require (
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
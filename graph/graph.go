@@ -0,0 +1,169 @@
+// Package graph draws the dependencies between the sessions of a config, as
+// Graphviz DOT or Mermaid, so that the order sessions start in can be seen at
+// a glance.
+package graph
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pglass/iterm-tool/config"
+)
+
+// Graph is the sessions of a config, with an edge from each session to each
+// session that depends on it.
+type Graph struct {
+	// Name is the id of the config.
+	Name  string
+	Nodes []Node
+	Edges []Edge
+}
+
+// What a session runs.
+const (
+	KindScript       = "script"
+	KindInject       = "inject"
+	KindScriptInject = "script+inject"
+)
+
+// Node is a session.
+type Node struct {
+	Name string
+	// Kind is what the session runs: KindScript, KindInject or
+	// KindScriptInject.
+	Kind string
+	// Group is the session's group, or "" if it is not in one.
+	Group string
+	// Ready lists the session's readiness checks, like "tcp localhost:8080".
+	Ready []string
+	// ReadyAfter is how long the session took to be ready the last time it
+	// ran, or 0 if that is not known.
+	ReadyAfter time.Duration
+	// Critical is set for the sessions on the critical path.
+	Critical bool
+}
+
+// Edge is a dependency: To waits for From.
+type Edge struct {
+	From, To string
+	// Critical is set for the edges of the critical path.
+	Critical bool
+}
+
+// New returns the graph of cfg. timings holds how long sessions took to be
+// ready in an earlier run, by name. Without timings, no session is critical.
+func New(cfg *config.Config, timings map[string]time.Duration) *Graph {
+	g := &Graph{Name: cfg.ID}
+	critical := map[string]bool{}
+	path := CriticalPath(cfg, timings)
+	for _, name := range path {
+		critical[name] = true
+	}
+	criticalEdges := map[Edge]bool{}
+	for i := 1; i < len(path); i++ {
+		criticalEdges[Edge{From: path[i-1], To: path[i]}] = true
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Sessions)) {
+		sess := cfg.Sessions[name]
+		node := Node{
+			Name:       name,
+			Kind:       kind(sess),
+			Ready:      readyChecks(sess.Ready),
+			ReadyAfter: timings[name],
+			Critical:   critical[name],
+		}
+		if group := sess.Group(); group != name {
+			node.Group = group
+		}
+		g.Nodes = append(g.Nodes, node)
+
+		deps := sess.Dependencies()
+		sort.Strings(deps)
+		for _, dep := range deps {
+			edge := Edge{From: dep, To: name}
+			edge.Critical = criticalEdges[edge]
+			g.Edges = append(g.Edges, edge)
+		}
+	}
+	return g
+}
+
+// CriticalPath returns the chain of dependencies that took longest to be
+// ready, according to timings, from the first session to the last. It
+// returns nil if timings is empty. Sessions without a timing count as
+// taking no time.
+func CriticalPath(cfg *config.Config, timings map[string]time.Duration) []string {
+	if len(timings) == 0 {
+		return nil
+	}
+
+	// finish is when a session is ready, if each session starts as soon as
+	// the sessions it depends on are ready. via is the dependency it waits
+	// for last.
+	finish := map[string]time.Duration{}
+	via := map[string]string{}
+	var visit func(name string) time.Duration
+	visit = func(name string) time.Duration {
+		if f, ok := finish[name]; ok {
+			return f
+		}
+		// Configs have no dependency cycles, see config.Config.Validate.
+		var start time.Duration
+		deps := cfg.Sessions[name].Dependencies()
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if f := visit(dep); f > start || via[name] == "" {
+				start, via[name] = f, dep
+			}
+		}
+		finish[name] = start + timings[name]
+		return finish[name]
+	}
+
+	last := ""
+	for _, name := range slices.Sorted(maps.Keys(cfg.Sessions)) {
+		if last == "" || visit(name) > finish[last] {
+			last = name
+		}
+	}
+	var path []string
+	for name := last; name != ""; name = via[name] {
+		path = append([]string{name}, path...)
+	}
+	return path
+}
+
+func kind(sess *config.Session) string {
+	switch {
+	case sess.Script != "" && sess.Inject != "":
+		return KindScriptInject
+	case sess.Script != "":
+		return KindScript
+	default:
+		return KindInject
+	}
+}
+
+// readyChecks describes each check of r, or returns nil if r is nil.
+func readyChecks(r *config.Ready) []string {
+	if r == nil {
+		return nil
+	}
+	var checks []string
+	for _, check := range []struct{ kind, value string }{
+		{"tcp", r.TCP},
+		{"http", r.HTTP},
+		{"file", r.File},
+		{"match", r.Match},
+		{"command", r.Command},
+	} {
+		if check.value != "" {
+			checks = append(checks, fmt.Sprintf("%s %s", check.kind, check.value))
+		}
+	}
+	return checks
+}
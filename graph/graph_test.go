@@ -0,0 +1,117 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pglass/iterm-tool/config"
+	"github.com/stretchr/testify/require"
+)
+
+func loadConfig(t *testing.T) *config.Config {
+	cfg, err := config.LoadConfig("data/TestNew.toml")
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestCriticalPath(t *testing.T) {
+	cfg := loadConfig(t)
+	tests := []struct {
+		name    string
+		timings map[string]time.Duration
+		expPath []string
+	}{
+		{name: "no-timings"},
+		{
+			name: "through-server",
+			timings: map[string]time.Duration{
+				"setup": 10 * time.Second, "db": 2 * time.Second, "server": 5 * time.Second,
+				"worker.1": time.Second, "worker.2": time.Second,
+			},
+			expPath: []string{"setup", "server", "worker.1"},
+		},
+		{
+			name: "slow-worker",
+			timings: map[string]time.Duration{
+				"setup": 10 * time.Second, "db": 2 * time.Second, "server": 5 * time.Second,
+				"worker.1": time.Second, "worker.2": 30 * time.Second,
+			},
+			expPath: []string{"setup", "worker.2"},
+		},
+		{
+			name:    "slow-db",
+			timings: map[string]time.Duration{"setup": time.Second, "db": 20 * time.Second, "server": time.Second},
+			expPath: []string{"db", "server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expPath, CriticalPath(cfg, tt.timings))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	g := New(loadConfig(t), map[string]time.Duration{"setup": 10 * time.Second, "server": 5 * time.Second})
+	require.Equal(t, &Graph{
+		Name: "test-graph",
+		Nodes: []Node{
+			{Name: "db", Kind: KindInject, Ready: []string{"tcp localhost:5432"}},
+			{Name: "server", Kind: KindScriptInject, Ready: []string{"http http://localhost:8080/health", `match Listening on "\S+"`}, ReadyAfter: 5 * time.Second, Critical: true},
+			{Name: "setup", Kind: KindScript, ReadyAfter: 10 * time.Second, Critical: true},
+			{Name: "worker.1", Kind: KindInject, Group: "worker"},
+			{Name: "worker.2", Kind: KindInject, Group: "worker"},
+		},
+		Edges: []Edge{
+			{From: "db", To: "server"},
+			{From: "setup", To: "server", Critical: true},
+			{From: "server", To: "worker.1"},
+			{From: "setup", To: "worker.2"},
+		},
+	}, g)
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := New(loadConfig(t), map[string]time.Duration{"setup": 10 * time.Second, "server": 5 * time.Second, "db": 4628886})
+	var b strings.Builder
+	require.NoError(t, g.WriteDOT(&b))
+	require.Equal(t, `digraph "test-graph" {
+  rankdir=LR;
+  "db" [label="db\ninject\nready: tcp localhost:5432\nready after 5ms", shape=ellipse];
+  "server" [label="server\nscript+inject\nready: http http://localhost:8080/health\nready: match Listening on \"\\S+\"\nready after 5s", shape=box, color="#d62728", penwidth=2];
+  "setup" [label="setup\nscript\nready after 10s", shape=box, color="#d62728", penwidth=2];
+  "worker.1" [label="worker.1\ninject\ngroup: worker", shape=ellipse];
+  "worker.2" [label="worker.2\ninject\ngroup: worker", shape=ellipse];
+  "db" -> "server";
+  "setup" -> "server" [color="#d62728", penwidth=2];
+  "server" -> "worker.1";
+  "setup" -> "worker.2";
+}
+`, b.String())
+}
+
+func TestWriteMermaid(t *testing.T) {
+	g := New(loadConfig(t), map[string]time.Duration{"setup": 10 * time.Second, "server": 5 * time.Second})
+	var b strings.Builder
+	require.NoError(t, g.WriteMermaid(&b))
+	require.Equal(t, `flowchart LR
+  s0("db<br/>inject<br/>ready: tcp localhost:5432")
+  s1["server<br/>script+inject<br/>ready: http http://localhost:8080/health<br/>ready: match Listening on #quot;\S+#quot;<br/>ready after 5s"]
+  s2["setup<br/>script<br/>ready after 10s"]
+  s3("worker.1<br/>inject<br/>group: worker")
+  s4("worker.2<br/>inject<br/>group: worker")
+  s0 --> s1
+  s2 --> s1
+  s1 --> s3
+  s2 --> s4
+  classDef critical stroke:#d62728,stroke-width:3px
+  class s1,s2 critical
+  linkStyle 1 stroke:#d62728,stroke-width:3px
+`, b.String())
+
+	// Without timings, nothing is highlighted.
+	b.Reset()
+	require.NoError(t, New(loadConfig(t), nil).WriteMermaid(&b))
+	require.NotContains(t, b.String(), "critical")
+}
@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// criticalColor marks the critical path.
+const criticalColor = "#d62728"
+
+// labelLines returns the lines of a node's label: its name and what is
+// known about it.
+func labelLines(n Node) []string {
+	lines := []string{n.Name, n.Kind}
+	if n.Group != "" {
+		lines = append(lines, "group: "+n.Group)
+	}
+	for _, check := range n.Ready {
+		lines = append(lines, "ready: "+check)
+	}
+	if n.ReadyAfter > 0 {
+		lines = append(lines, "ready after "+roundDuration(n.ReadyAfter).String())
+	}
+	return lines
+}
+
+// roundDuration rounds d to a precision that suits its size: tenths of a
+// second, or milliseconds under a second.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
+
+// WriteDOT writes the graph in Graphviz's DOT language. Sessions with a
+// script are boxes, and the others are ellipses. The critical path is drawn
+// in bold red.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(g.Name))
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		var lines []string
+		for _, line := range labelLines(n) {
+			lines = append(lines, dotEscape(line))
+		}
+		shape := "ellipse"
+		if n.Kind != KindInject {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [label=\"%s\", shape=%s", dotQuote(n.Name), strings.Join(lines, `\n`), shape)
+		if n.Critical {
+			fmt.Fprintf(&b, ", color=%q, penwidth=2", criticalColor)
+		}
+		b.WriteString("];\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(e.From), dotQuote(e.To))
+		if e.Critical {
+			fmt.Fprintf(&b, " [color=%q, penwidth=2]", criticalColor)
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns s as a quoted DOT id.
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart. Sessions with a
+// script are rectangles, and the others have rounded corners. The critical
+// path is drawn in bold red.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	// Session names may hold characters Mermaid ids cannot, like dots.
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.Name] = "s" + strconv.Itoa(i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	var critical []string
+	for _, n := range g.Nodes {
+		var lines []string
+		for _, line := range labelLines(n) {
+			lines = append(lines, mermaidEscape(line))
+		}
+		left, right := "(", ")"
+		if n.Kind != KindInject {
+			left, right = "[", "]"
+		}
+		fmt.Fprintf(&b, "  %s%s\"%s\"%s\n", ids[n.Name], left, strings.Join(lines, "<br/>"), right)
+		if n.Critical {
+			critical = append(critical, ids[n.Name])
+		}
+	}
+	var criticalLinks []string
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s --> %s\n", ids[e.From], ids[e.To])
+		if e.Critical {
+			criticalLinks = append(criticalLinks, strconv.Itoa(i))
+		}
+	}
+	if len(critical) > 0 {
+		fmt.Fprintf(&b, "  classDef critical stroke:%s,stroke-width:3px\n", criticalColor)
+		fmt.Fprintf(&b, "  class %s critical\n", strings.Join(critical, ","))
+	}
+	if len(criticalLinks) > 0 {
+		fmt.Fprintf(&b, "  linkStyle %s stroke:%s,stroke-width:3px\n", strings.Join(criticalLinks, ","), criticalColor)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidEscape escapes the characters that would end a quoted Mermaid
+// label, or be read as HTML.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
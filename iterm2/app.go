@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,10 +14,10 @@ import (
 type App interface {
 	io.Closer
 
-	CreateWindow(*CreateWindowOpts) (Window, error)
-	ListWindows() ([]Window, error)
-	SelectMenuItem(item string) error
-	Activate(raiseAllWindows, ignoreOtherApps bool) error
+	CreateWindow(ctx context.Context, opts *CreateWindowOpts) (Window, error)
+	ListWindows(ctx context.Context) ([]Window, error)
+	SelectMenuItem(ctx context.Context, item string) error
+	Activate(ctx context.Context, raiseAllWindows, ignoreOtherApps bool) error
 }
 
 type CreateWindowOpts struct {
@@ -75,12 +76,23 @@ func NewApp(name string) (App, error) {
 	return &app{c: c}, nil
 }
 
+// NewAppWithOptions is like NewApp, but connects to iTerm2
+// as described by opts.
+func NewAppWithOptions(name string, opts client.Options) (App, error) {
+	c, err := client.NewWithOptions(name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &app{c: c}, nil
+}
+
 type app struct {
 	c *client.Client
 }
 
-func (a *app) Activate(raiseAllWindows bool, ignoreOtherApps bool) error {
-	_, err := a.c.Call(&api.ClientOriginatedMessage{
+func (a *app) Activate(ctx context.Context, raiseAllWindows bool, ignoreOtherApps bool) error {
+	_, err := a.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_ActivateRequest{ActivateRequest: &api.ActivateRequest{
 			OrderWindowFront: b(true),
 			ActivateApp: &api.ActivateRequest_App{
@@ -92,7 +104,7 @@ func (a *app) Activate(raiseAllWindows bool, ignoreOtherApps bool) error {
 	return err
 }
 
-func (a *app) CreateWindow(opts *CreateWindowOpts) (Window, error) {
+func (a *app) CreateWindow(ctx context.Context, opts *CreateWindowOpts) (Window, error) {
 	var customProps []*api.ProfileProperty
 	if opts != nil {
 		props, err := opts.CustomProfileProperties.toProperties()
@@ -102,7 +114,7 @@ func (a *app) CreateWindow(opts *CreateWindowOpts) (Window, error) {
 		customProps = props
 	}
 
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
+	resp, err := a.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
 			CreateTabRequest: &api.CreateTabRequest{
 				CustomProfileProperties: customProps,
@@ -123,9 +135,9 @@ func (a *app) CreateWindow(opts *CreateWindowOpts) (Window, error) {
 	}, nil
 }
 
-func (a *app) ListWindows() ([]Window, error) {
+func (a *app) ListWindows(ctx context.Context) ([]Window, error) {
 	list := []Window{}
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
+	resp, err := a.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
 			ListSessionsRequest: &api.ListSessionsRequest{},
 		},
@@ -154,8 +166,8 @@ func b(b bool) *bool {
 	return &b
 }
 
-func (a *app) SelectMenuItem(item string) error {
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
+func (a *app) SelectMenuItem(ctx context.Context, item string) error {
+	resp, err := a.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_MenuItemRequest{
 			MenuItemRequest: &api.MenuItemRequest{
 				Identifier: &item,
@@ -0,0 +1,284 @@
+package iterm2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"github.com/pglass/iterm-tool/iterm2/iterm2test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestApp(t *testing.T) (App, *iterm2test.Server) {
+	srv := iterm2test.NewServer()
+	t.Cleanup(func() { srv.Close() })
+
+	app, err := NewAppWithOptions("test", srv.ClientOptions())
+	require.NoError(t, err)
+	t.Cleanup(func() { app.Close() })
+	return app, srv
+}
+
+func TestCreateWindow(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, window.SetTitle(ctx, "my-window"))
+
+	windows, err := app.ListWindows(ctx)
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+	require.Equal(t, window.ID(), windows[0].ID())
+
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	require.Len(t, tabs, 1)
+
+	_, err = window.CreateTab(ctx)
+	require.NoError(t, err)
+	tabs, err = window.ListTabs(ctx)
+	require.NoError(t, err)
+	require.Len(t, tabs, 2)
+
+	snap := srv.Windows()
+	require.Len(t, snap, 1)
+	require.Equal(t, "my-window", snap[0].Title)
+
+	require.NoError(t, window.Close(ctx, true))
+	windows, err = app.ListWindows(ctx)
+	require.NoError(t, err)
+	require.Empty(t, windows)
+}
+
+func TestSplitPane(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	sessions, err := tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	// Two columns. The right column is split into two rows.
+	left := sessions[0]
+	right, err := left.SplitPane(ctx, SplitPaneOptions{Vertical: true})
+	require.NoError(t, err)
+	bottomRight, err := right.SplitPane(ctx, SplitPaneOptions{})
+	require.NoError(t, err)
+
+	sessions, err = tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.GetSessionID())
+	}
+	require.Equal(t, []string{left.GetSessionID(), right.GetSessionID(), bottomRight.GetSessionID()}, ids)
+	require.Equal(t, ids, srv.Windows()[0].Tabs[0].SessionIDs)
+
+	require.NoError(t, right.Close(ctx, true))
+	require.Equal(t, []string{left.GetSessionID(), bottomRight.GetSessionID()}, srv.Windows()[0].Tabs[0].SessionIDs)
+	require.ErrorContains(t, right.Close(ctx, true), "NOT_FOUND")
+}
+
+func TestSetLayout(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	sessions, err := tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	left := sessions[0]
+	right, err := left.SplitPane(ctx, SplitPaneOptions{Vertical: true})
+	require.NoError(t, err)
+
+	root, err := tabs[0].Layout(ctx)
+	require.NoError(t, err)
+	require.True(t, root.GetVertical())
+	require.Len(t, root.GetLinks(), 2)
+	leftSize := root.GetLinks()[0].GetSession().GetGridSize()
+	rightSize := root.GetLinks()[1].GetSession().GetGridSize()
+	require.Equal(t, int32(40), leftSize.GetWidth())
+	require.Equal(t, int32(40), rightSize.GetWidth())
+
+	// Widen the left pane. The total width stays the same.
+	leftSize.Width = proto.Int32(60)
+	rightSize.Width = proto.Int32(20)
+	require.NoError(t, tabs[0].SetLayout(ctx, root))
+	snap, ok := srv.Session(left.GetSessionID())
+	require.True(t, ok)
+	require.Equal(t, 60, snap.Width)
+	snap, ok = srv.Session(right.GetSessionID())
+	require.True(t, ok)
+	require.Equal(t, 20, snap.Width)
+
+	rightSize.Width = proto.Int32(30)
+	require.ErrorContains(t, tabs[0].SetLayout(ctx, root), "INVALID_SIZE")
+
+	root.Links = root.Links[:1]
+	require.ErrorContains(t, tabs[0].SetLayout(ctx, root), "WRONG_TREE")
+}
+
+func TestSession(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	sessions, err := tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	sess := sessions[0]
+
+	require.NoError(t, sess.SetName(ctx, "server"))
+	require.NoError(t, sess.SendText(ctx, "echo hello\n"))
+
+	snap, ok := srv.Session(sess.GetSessionID())
+	require.True(t, ok)
+	require.Equal(t, "server", snap.Name)
+	require.Equal(t, "echo hello\n", snap.Text)
+
+	require.NoError(t, sess.SendText(ctx, "echo world\n"))
+	buf, err := sess.GetBuffer(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, Buffer{Lines: []string{"echo world"}, FirstLine: 1, CursorLine: 2, Continued: []bool{false}}, buf)
+
+	jobName, err := sess.GetVariable(ctx, "jobName")
+	require.NoError(t, err)
+	require.Equal(t, `"bash"`, jobName)
+
+	require.NoError(t, srv.SetVariable(sess.GetSessionID(), "jobName", "python3"))
+	jobName, err = sess.GetVariable(ctx, "jobName")
+	require.NoError(t, err)
+	require.Equal(t, `"python3"`, jobName)
+
+	require.NoError(t, window.Close(ctx, true))
+	_, err = sess.GetVariable(ctx, "jobName")
+	require.Error(t, err)
+	require.Error(t, sess.SendText(ctx, "echo hello\n"))
+}
+
+func TestRestartSession(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	sessions, err := tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	sess := sessions[0]
+	require.NoError(t, sess.SendText(ctx, "make serve\n"))
+
+	// A running session is only restarted on demand.
+	require.ErrorContains(t, sess.Restart(ctx, true), "SESSION_NOT_RESTARTABLE")
+	require.NoError(t, sess.Restart(ctx, false))
+	snap, ok := srv.Session(sess.GetSessionID())
+	require.True(t, ok)
+	require.Equal(t, 1, snap.Restarts)
+	require.Empty(t, snap.Text)
+
+	require.NoError(t, srv.ExitSession(sess.GetSessionID()))
+	require.NoError(t, sess.Restart(ctx, true))
+	snap, _ = srv.Session(sess.GetSessionID())
+	require.Equal(t, 2, snap.Restarts)
+	require.False(t, snap.Exited)
+
+	require.NoError(t, window.Close(ctx, true))
+	require.ErrorContains(t, sess.Restart(ctx, false), "SESSION_NOT_FOUND")
+}
+
+func TestRunCommand(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	sessions, err := tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	sess := sessions[0]
+	id := sess.GetSessionID()
+
+	ok, err := sess.HasShellIntegration(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, srv.EnableShellIntegration(id))
+	ok, err = sess.HasShellIntegration(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	type result struct {
+		CommandResult
+		err error
+	}
+	results := make(chan result)
+	go func() {
+		r, err := sess.RunCommand(ctx, "make\n")
+		results <- result{r, err}
+	}()
+	require.Eventually(t, func() bool {
+		snap, _ := srv.Session(id)
+		return snap.Text == "make\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	prompt := func(p *api.PromptNotification) {
+		p.Session = proto.String(id)
+		srv.Notify(&api.Notification{PromptNotification: p})
+	}
+	// The end of a command that was already running is ignored.
+	prompt(&api.PromptNotification{Event: &api.PromptNotification_CommandEnd{
+		CommandEnd: &api.PromptNotificationCommandEnd{Status: proto.Int32(1)},
+	}})
+	prompt(&api.PromptNotification{Event: &api.PromptNotification_CommandStart{
+		CommandStart: &api.PromptNotificationCommandStart{Command: proto.String("make")},
+	}})
+	before := time.Now()
+	prompt(&api.PromptNotification{Event: &api.PromptNotification_CommandEnd{
+		CommandEnd: &api.PromptNotificationCommandEnd{Status: proto.Int32(2)},
+	}})
+
+	r := <-results
+	require.NoError(t, r.err)
+	require.Equal(t, 2, r.ExitStatus)
+	require.False(t, r.End.Before(before))
+}
+
+func TestRunCommandSessionClosed(t *testing.T) {
+	app, srv := newTestApp(t)
+	ctx := context.Background()
+
+	window, err := app.CreateWindow(ctx, nil)
+	require.NoError(t, err)
+	tabs, err := window.ListTabs(ctx)
+	require.NoError(t, err)
+	sessions, err := tabs[0].ListSessions(ctx)
+	require.NoError(t, err)
+	sess := sessions[0]
+
+	errs := make(chan error)
+	go func() {
+		_, err := sess.RunCommand(ctx, "sleep infinity\n")
+		errs <- err
+	}()
+	require.Eventually(t, func() bool {
+		snap, _ := srv.Session(sess.GetSessionID())
+		return snap.Text != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, window.Close(ctx, true))
+	require.ErrorContains(t, <-errs, "terminated")
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -9,16 +10,52 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/andybrewer/mack"
 	"github.com/gorilla/websocket"
 	"github.com/pglass/iterm-tool/iterm2/api"
 	"google.golang.org/protobuf/proto"
 )
 
+// DefaultTCPAddress is the legacy TCP port that older versions of iTerm2 listen on.
+const DefaultTCPAddress = "localhost:1912"
+
+// Options configure how a Client connects to iTerm2.
+type Options struct {
+	// SocketPath is the unix socket to connect to. Defaults to iTerm2's
+	// socket at ~/Library/Application Support/iTerm2/private/socket.
+	SocketPath string
+	// TCPAddress connects over TCP instead of the unix socket, for example to
+	// DefaultTCPAddress. Must not be set together with SocketPath.
+	TCPAddress string
+	// HandshakeTimeout bounds the websocket handshake. Defaults to 45 seconds.
+	HandshakeTimeout time.Duration
+	// CallTimeout bounds the calls the client makes on its own, to renew
+	// subscriptions after reconnecting and to unsubscribe. Defaults to 10
+	// seconds.
+	CallTimeout time.Duration
+	// Cookies authenticates the client. Defaults to AppleScriptCookie.
+	Cookies CookieProvider
+	// Reconnect makes the client dial iTerm2 again when the connection is
+	// lost, and renew its notification subscriptions. Calls in flight when
+	// the connection drops, or made before it is back, fail with
+	// ErrConnectionLost.
+	Reconnect bool
+}
+
+var (
+	// ErrClosed is returned by calls on a closed Client.
+	ErrClosed = errors.New("client is closed")
+	// ErrConnectionLost is returned by calls when the connection to iTerm2 is lost.
+	ErrConnectionLost = errors.New("connection to iTerm2 lost")
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
 // New returns a new websocket connection that talks to the iTerm2
 // application.New Callers must call the Close() method when done. The cookie
 // parameter is optional. If provided, it will bypass script authentication
@@ -30,48 +67,91 @@ func New(appName string) (*Client, error) {
 	// try to generate a new cookie instead. See
 	// https://github.com/marwan-at-work/iterm2/issues/4
 	if cookie := os.Getenv("ITERM2_COOKIE"); cookie != "" {
-		client, err := newClient(appName, cookie)
+		client, err := newClient(appName, Options{Cookies: EnvCookie{}})
 		if err == nil {
 			return client, nil
 		}
 	}
-	client, err := newClient(appName, "")
+	client, err := newClient(appName, Options{})
 	if err != nil {
 		return nil, err
 	}
 	return client, err
 }
 
-func newClient(appName, cookie string) (*Client, error) {
+// NewWithOptions is like New, but connects as described by opts instead of
+// using the defaults. Use it to connect to a fake server in tests (see the
+// iterm2test package) or to pass pre-fetched credentials.
+func NewWithOptions(appName string, opts Options) (*Client, error) {
+	return newClient(appName, opts)
+}
+
+func newClient(appName string, opts Options) (*Client, error) {
+	if opts.SocketPath != "" && opts.TCPAddress != "" {
+		return nil, fmt.Errorf("only one of SocketPath or TCPAddress may be set")
+	}
+	if opts.Cookies == nil {
+		opts.Cookies = AppleScriptCookie{}
+	}
+	if opts.HandshakeTimeout == 0 {
+		opts.HandshakeTimeout = 45 * time.Second
+	}
+	if opts.CallTimeout == 0 {
+		opts.CallTimeout = 10 * time.Second
+	}
+	if opts.TCPAddress == "" && opts.SocketPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("os.UserHomeDir: %w", err)
+		}
+		opts.SocketPath = filepath.Join(homeDir, "/Library/Application Support/iTerm2/private/socket")
+	}
+
+	cl := &Client{
+		appName: appName,
+		opts:    opts,
+		done:    make(chan struct{}),
+		rpcs:    make(map[int64]chan<- *api.ServerOriginatedMessage),
+		subs:    make(map[string]*api.NotificationRequest),
+
+		subscribers:   make(map[*subscriber]struct{}),
+		subscriptions: make(map[string]*subscription),
+	}
+	ws, err := cl.dial()
+	if err != nil {
+		return nil, err
+	}
+	cl.setConn(ws)
+	return cl, nil
+}
+
+func (c *Client) dial() (*websocket.Conn, error) {
 	h := http.Header{}
 	h.Set("origin", "ws://localhost/")
 	h.Set("x-iterm2-library-version", "go 3.6")
 	h.Set("x-iterm2-disable-auth-ui", "true")
-	if cookie == "" {
-		resp, err := mack.Tell("iTerm2", fmt.Sprintf("request cookie and key for app named %q", appName))
-		if err != nil {
-			return nil, fmt.Errorf("AppleScript/tell: %w", err)
-		}
-		fields := strings.Fields(resp)
-		if len(fields) != 2 {
-			return nil, fmt.Errorf("incorrect field format: %q", resp)
-		}
-		cookie = fields[0]
-		h.Set("x-iterm2-key", fields[1])
+	cookie, key, err := c.opts.Cookies.CookieAndKey(c.appName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting cookie: %w", err)
 	}
 	h.Set("x-iterm2-cookie", cookie)
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("os.UserHomeDir: %w", err)
+	if key != "" {
+		h.Set("x-iterm2-key", key)
 	}
+
 	d := &websocket.Dialer{
-		NetDial: func(network, addr string) (net.Conn, error) {
-			return net.Dial("unix", filepath.Join(homeDir, "/Library/Application Support/iTerm2/private/socket"))
-		},
-		HandshakeTimeout: 45 * time.Second,
+		HandshakeTimeout: c.opts.HandshakeTimeout,
 		Subprotocols:     []string{"api.iterm2.com"},
 	}
-	c, resp, err := d.Dial("ws://localhost", h)
+	url := "ws://localhost"
+	if c.opts.TCPAddress != "" {
+		url = "ws://" + c.opts.TCPAddress
+	} else {
+		d.NetDial = func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", c.opts.SocketPath)
+		}
+	}
+	ws, resp, err := d.Dial(url, h)
 	if err != nil && resp != nil {
 		b, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("error connecting to iTerm2: %v - body: %s", err, b)
@@ -79,49 +159,85 @@ func newClient(appName, cookie string) (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to iTerm2: %v", err)
 	}
-	cl := &Client{
-		c:       c,
-		rpcs:    make(map[int64]chan<- *api.ServerOriginatedMessage),
-		writeCh: make(chan writeReq),
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	cl.cancel = cancel
-	go cl.readWorker(ctx)
-	go cl.writeWorker()
-	return cl, nil
+	return ws, nil
 }
 
 // Client wraps a websocket client connection to iTerm2.
 // Must be instantiated with NewClient.
 type Client struct {
-	c       *websocket.Conn
+	appName string
+	opts    Options
+	// done is closed by Close.
+	done chan struct{}
+
+	// writeMu serializes writes to the websocket.
+	writeMu sync.Mutex
+
+	mu sync.Mutex
+	// ws is the current connection. It is nil while reconnecting, or once closed.
+	ws *websocket.Conn
+	// lost is closed when ws is lost or closed. lostErr says why.
+	lost    chan struct{}
+	lostErr error
+	closed  bool
 	rpcs    map[int64]chan<- *api.ServerOriginatedMessage
-	mu      sync.Mutex
-	cancel  context.CancelFunc
-	writeCh chan writeReq
+	// subs holds active notification subscriptions, to renew them after reconnecting.
+	subs map[string]*api.NotificationRequest
+	// subscribers receive notifications. See Subscribe.
+	subscribers map[*subscriber]struct{}
+	// subscriptions holds the subscriptions of subscribers with iTerm2, by
+	// subscription key, from when the first subscriber asks for one.
+	subscriptions map[string]*subscription
 }
 
-type writeReq struct {
-	msg  []byte
-	resp chan error
+// setConn makes ws the current connection and starts reading from it. Once
+// the client is closed, it reports false and leaves ws to the caller.
+func (c *Client) setConn(ws *websocket.Conn) bool {
+	lost := make(chan struct{})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.ws = ws
+	c.lost = lost
+	c.lostErr = nil
+	go c.readWorker(ws, lost)
+	return true
 }
 
-func (c *Client) writeWorker() {
-	for req := range c.writeCh {
-		err := c.c.WriteMessage(websocket.BinaryMessage, req.msg)
-		req.resp <- err
+// dropConn forgets ws, if it is still the current connection, and fails
+// calls waiting on it with err.
+func (c *Client) dropConn(ws *websocket.Conn, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ws != ws {
+		return false
 	}
+	c.ws = nil
+	c.lostErr = err
+	close(c.lost)
+	c.rpcs = make(map[int64]chan<- *api.ServerOriginatedMessage)
+	return true
 }
 
-func (c *Client) readWorker(ctx context.Context) {
+func (c *Client) readWorker(ws *websocket.Conn, lost chan struct{}) {
 	for {
-		_, msg, err := c.c.ReadMessage()
-		if ctx.Err() != nil {
-			return
-		}
+		_, msg, err := ws.ReadMessage()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			continue
+			// The websocket is unusable after a read error.
+			ws.Close()
+			if !c.dropConn(ws, fmt.Errorf("%w: %v", ErrConnectionLost, err)) {
+				// Closed by Close.
+				return
+			}
+			fmt.Fprintf(os.Stderr, "connection to iTerm2 lost: %v\n", err)
+			if c.opts.Reconnect {
+				go c.reconnect()
+			} else {
+				c.stopSubscribers()
+			}
+			return
 		}
 		var resp api.ServerOriginatedMessage
 		err = proto.Unmarshal(msg, &resp)
@@ -129,6 +245,10 @@ func (c *Client) readWorker(ctx context.Context) {
 			fmt.Fprintln(os.Stderr, err)
 			continue
 		}
+		if n := resp.GetNotification(); n != nil {
+			c.dispatch(n)
+			continue
+		}
 		c.mu.Lock()
 		ch, ok := c.rpcs[resp.GetId()]
 		delete(c.rpcs, resp.GetId())
@@ -141,37 +261,188 @@ func (c *Client) readWorker(ctx context.Context) {
 	}
 }
 
+// reconnect dials iTerm2 until it succeeds or the client is closed,
+// then renews notification subscriptions.
+func (c *Client) reconnect() {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+
+		ws, err := c.dial()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reconnecting to iTerm2: %v\n", err)
+			delay = min(2*delay, maxReconnectDelay)
+			continue
+		}
+
+		// Checking for Close and installing ws happen at once, or else a
+		// Close in between would leave ws open.
+		if !c.setConn(ws) {
+			ws.Close()
+			return
+		}
+		fmt.Fprintln(os.Stderr, "reconnected to iTerm2")
+		c.resubscribe()
+		return
+	}
+}
+
+func (c *Client) resubscribe() {
+	c.mu.Lock()
+	var reqs []*api.NotificationRequest
+	for _, req := range c.subs {
+		reqs = append(reqs, req)
+	}
+	c.mu.Unlock()
+
+	for _, req := range reqs {
+		ctx, cancel := context.WithTimeout(context.Background(), c.opts.CallTimeout)
+		_, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+			Submessage: &api.ClientOriginatedMessage_NotificationRequest{
+				NotificationRequest: req,
+			},
+		})
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "renewing subscription to %s: %v\n", req.GetNotificationType(), err)
+		}
+	}
+}
+
+// trackSubscription remembers (or forgets) a successful notification
+// subscription so that it can be renewed after reconnecting.
+func (c *Client) trackSubscription(req *api.NotificationRequest, resp *api.ServerOriginatedMessage) {
+	status := resp.GetNotificationResponse().GetStatus()
+	if status != api.NotificationResponse_OK && status != api.NotificationResponse_ALREADY_SUBSCRIBED {
+		return
+	}
+
+	key, err := subscriptionKey(req)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if req.GetSubscribe() {
+		c.subs[key] = req
+	} else {
+		delete(c.subs, key)
+	}
+}
+
 // Call sends a request to the iTerm2 server
 func (c *Client) Call(req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	return c.CallContext(context.Background(), req)
+}
+
+// CallContext sends a request to the iTerm2 server and waits for the response
+// until ctx is done. If ctx is done first, the call is abandoned and a late
+// response from iTerm2 is dropped.
+//
+// If the client is closed, or the connection is lost, before the response
+// arrives, CallContext returns an error wrapping ErrClosed or ErrConnectionLost.
+func (c *Client) CallContext(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
 	req.Id = id(rand.Int63())
 	ch := make(chan *api.ServerOriginatedMessage, 1)
+
 	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	ws, lost := c.ws, c.lost
+	if ws == nil {
+		err := c.lostErr
+		c.mu.Unlock()
+		return nil, err
+	}
 	c.rpcs[req.GetId()] = ch
 	c.mu.Unlock()
+	abandon := func() {
+		c.mu.Lock()
+		delete(c.rpcs, req.GetId())
+		c.mu.Unlock()
+	}
+	lostErr := func() error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.lostErr
+	}
+
 	msg, err := proto.Marshal(req)
 	if err != nil {
+		abandon()
 		return nil, err
 	}
-	wr := writeReq{msg: msg, resp: make(chan error, 1)}
-	c.writeCh <- wr
-	err = <-wr.resp
-	if err != nil {
+	if err := c.write(ctx, ws, msg); err != nil {
+		abandon()
+		select {
+		case <-lost:
+			return nil, lostErr()
+		default:
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("error writing to websocket: %w", err)
 	}
-	resp := <-ch
+
+	var resp *api.ServerOriginatedMessage
+	select {
+	case resp = <-ch:
+	case <-lost:
+		return nil, lostErr()
+	case <-ctx.Done():
+		abandon()
+		return nil, ctx.Err()
+	}
 	if resp.GetError() != "" {
 		return nil, fmt.Errorf("error from server: %v", resp.GetError())
 	}
+	if nr := req.GetNotificationRequest(); nr != nil {
+		c.trackSubscription(nr, resp)
+	}
 	return resp, nil
 }
 
+// write sends msg on ws, giving up when ctx is done.
+func (c *Client) write(ctx context.Context, ws *websocket.Conn, msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	deadline, _ := ctx.Deadline()
+	// A zero deadline means no deadline.
+	ws.SetWriteDeadline(deadline)
+	return ws.WriteMessage(websocket.BinaryMessage, msg)
+}
+
 // Close closes the websocket connection
-// and frees any goroutine resources
+// and frees any goroutine resources.
+// Calls in flight fail with ErrClosed.
 func (c *Client) Close() error {
-	// TODO: if a *Client.Call is in flight, this will cause it to panic
-	close(c.writeCh)
-	c.cancel()
-	return c.c.Close()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	ws := c.ws
+	c.mu.Unlock()
+
+	c.stopSubscribers()
+	if ws == nil {
+		return nil
+	}
+	c.dropConn(ws, ErrClosed)
+	return ws.Close()
 }
 
 func id(i int64) *int64 {
@@ -0,0 +1,467 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"github.com/pglass/iterm-tool/iterm2/client"
+	"github.com/pglass/iterm-tool/iterm2/iterm2test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func listSessions(t *testing.T, c *client.Client) {
+	_, err := c.Call(&api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
+			ListSessionsRequest: &api.ListSessionsRequest{},
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		tcp       bool
+		env       map[string]string
+		cookies   client.CookieProvider
+		expCookie string
+		expKey    string
+		expError  string
+	}{
+		{
+			name:      "static-cookie",
+			cookies:   client.StaticCookie{Cookie: "c1", Key: "k1"},
+			expCookie: "c1",
+			expKey:    "k1",
+		},
+		{
+			name:      "env-cookie",
+			env:       map[string]string{"ITERM2_COOKIE": "c2", "ITERM2_KEY": "k2"},
+			cookies:   client.EnvCookie{},
+			expCookie: "c2",
+			expKey:    "k2",
+		},
+		{
+			name:     "env-cookie-unset",
+			env:      map[string]string{"ITERM2_COOKIE": ""},
+			cookies:  client.EnvCookie{},
+			expError: "ITERM2_COOKIE is not set",
+		},
+		{
+			name:      "tcp",
+			tcp:       true,
+			cookies:   client.StaticCookie{Cookie: "c3"},
+			expCookie: "c3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var srv *iterm2test.Server
+			if tt.tcp {
+				srv = iterm2test.NewTCPServer()
+			} else {
+				srv = iterm2test.NewServer()
+			}
+			defer srv.Close()
+
+			opts := srv.ClientOptions()
+			opts.Cookies = tt.cookies
+			c, err := client.NewWithOptions("test", opts)
+			if len(tt.expError) != 0 {
+				require.ErrorContains(t, err, tt.expError)
+				return
+			}
+			require.NoError(t, err)
+			defer c.Close()
+
+			listSessions(t, c)
+			require.Equal(t, tt.expCookie, srv.Header().Get("x-iterm2-cookie"))
+			require.Equal(t, tt.expKey, srv.Header().Get("x-iterm2-key"))
+		})
+	}
+}
+
+func TestNewWithOptionsSocketAndTCP(t *testing.T) {
+	_, err := client.NewWithOptions("test", client.Options{
+		SocketPath: "/tmp/socket",
+		TCPAddress: client.DefaultTCPAddress,
+		Cookies:    client.StaticCookie{Cookie: "c"},
+	})
+	require.ErrorContains(t, err, "only one of SocketPath or TCPAddress")
+}
+
+func TestCallContext(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.ClientOptions())
+	require.NoError(t, err)
+	defer c.Close()
+
+	resume := srv.Stall()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
+			ListSessionsRequest: &api.ListSessionsRequest{},
+		},
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The late response to the abandoned call is dropped, and the client keeps working.
+	resume()
+	listSessions(t, c)
+}
+
+func TestCloseWithCallInFlight(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.ClientOptions())
+	require.NoError(t, err)
+
+	resume := srv.Stall()
+	defer resume()
+	errs := make(chan error)
+	go func() {
+		_, err := c.Call(&api.ClientOriginatedMessage{
+			Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
+				ListSessionsRequest: &api.ListSessionsRequest{},
+			},
+		})
+		errs <- err
+	}()
+
+	// Give the call time to get to the server.
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, c.Close())
+	require.ErrorIs(t, <-errs, client.ErrClosed)
+
+	_, err = c.Call(&api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
+			ListSessionsRequest: &api.ListSessionsRequest{},
+		},
+	})
+	require.ErrorIs(t, err, client.ErrClosed)
+	require.NoError(t, c.Close())
+}
+
+func TestConnectionLost(t *testing.T) {
+	for _, reconnect := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reconnect=%v", reconnect), func(t *testing.T) {
+			srv := iterm2test.NewServer()
+			defer srv.Close()
+			opts := srv.ClientOptions()
+			opts.Reconnect = reconnect
+			c, err := client.NewWithOptions("test", opts)
+			require.NoError(t, err)
+			defer c.Close()
+
+			call := func() error {
+				_, err := c.Call(&api.ClientOriginatedMessage{
+					Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
+						ListSessionsRequest: &api.ListSessionsRequest{},
+					},
+				})
+				return err
+			}
+
+			resume := srv.Stall()
+			errs := make(chan error)
+			go func() { errs <- call() }()
+			time.Sleep(50 * time.Millisecond)
+			srv.DropConnections()
+			resume()
+			require.ErrorIs(t, <-errs, client.ErrConnectionLost)
+
+			if !reconnect {
+				require.ErrorIs(t, call(), client.ErrConnectionLost)
+				return
+			}
+			require.Eventually(t, func() bool { return call() == nil }, 5*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestCloseWhileReconnecting(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	opts := srv.ClientOptions()
+	opts.Reconnect = true
+
+	var clients []*client.Client
+	for i := 0; i < 40; i++ {
+		c, err := client.NewWithOptions("test", opts)
+		require.NoError(t, err)
+		clients = append(clients, c)
+	}
+	srv.DropConnections()
+
+	// The clients dial again after half a second. Close them around then,
+	// some before they dial, some while they do, and some after.
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(450*time.Millisecond + time.Duration(i)*5*time.Millisecond)
+			require.NoError(t, c.Close())
+		}()
+	}
+	wg.Wait()
+
+	// No client is left connected.
+	require.Eventually(t, func() bool { return srv.Connections() == 0 }, 5*time.Second, 50*time.Millisecond)
+	for _, c := range clients {
+		_, err := c.Call(&api.ClientOriginatedMessage{
+			Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
+				ListSessionsRequest: &api.ListSessionsRequest{},
+			},
+		})
+		require.ErrorIs(t, err, client.ErrClosed)
+	}
+}
+
+func promptNotification(session string) *api.Notification {
+	return &api.Notification{
+		PromptNotification: &api.PromptNotification{Session: proto.String(session)},
+	}
+}
+
+func receive(t *testing.T, ch <-chan *api.Notification) *api.Notification {
+	t.Helper()
+	select {
+	case n, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for notification")
+		return nil
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.ClientOptions())
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	all, unsubscribeAll, err := c.Subscribe(ctx, &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+		Session:          proto.String("all"),
+	})
+	require.NoError(t, err)
+	one, unsubscribeOne, err := c.Subscribe(ctx, &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+		Session:          proto.String("s1"),
+	})
+	require.NoError(t, err)
+	// A second subscriber to the same notifications shares the subscription.
+	dup, unsubscribeDup, err := c.Subscribe(ctx, &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+		Session:          proto.String("s1"),
+	})
+	require.NoError(t, err)
+
+	srv.Notify(promptNotification("s2"))
+	srv.Notify(promptNotification("s1"))
+	require.Equal(t, "s2", receive(t, all).PromptNotification.GetSession())
+	require.Equal(t, "s1", receive(t, all).PromptNotification.GetSession())
+	require.Equal(t, "s1", receive(t, one).PromptNotification.GetSession())
+	require.Equal(t, "s1", receive(t, dup).PromptNotification.GetSession())
+
+	unsubscribeDup()
+	_, ok := <-dup
+	require.False(t, ok)
+	srv.Notify(promptNotification("s1"))
+	require.Equal(t, "s1", receive(t, one).PromptNotification.GetSession())
+	require.Equal(t, "s1", receive(t, all).PromptNotification.GetSession())
+
+	unsubscribeOne()
+	unsubscribeAll()
+	unsubscribeAll()
+	_, ok = <-all
+	require.False(t, ok)
+}
+
+func TestSubscribeInFlight(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fail=%v", fail), func(t *testing.T) {
+			srv := iterm2test.NewServer()
+			defer srv.Close()
+			c, err := client.NewWithOptions("test", srv.ClientOptions())
+			require.NoError(t, err)
+			defer c.Close()
+			req := &api.NotificationRequest{
+				NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+			}
+
+			type result struct {
+				ch          <-chan *api.Notification
+				unsubscribe func()
+				err         error
+			}
+			subscribe := func(ctx context.Context) <-chan result {
+				results := make(chan result, 1)
+				go func() {
+					ch, unsubscribe, err := c.Subscribe(ctx, req)
+					results <- result{ch, unsubscribe, err}
+				}()
+				return results
+			}
+
+			// The first subscriber's request is stuck, and fails if its
+			// context ends first.
+			resume := srv.Stall()
+			ctx := context.Background()
+			if fail {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+				defer cancel()
+			}
+			first := subscribe(ctx)
+			time.Sleep(50 * time.Millisecond)
+			// The second subscriber waits for the first one's answer.
+			second := subscribe(context.Background())
+			select {
+			case <-second:
+				t.Fatal("second subscriber did not wait for the first")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			if fail {
+				require.ErrorIs(t, (<-first).err, context.DeadlineExceeded)
+				require.ErrorIs(t, (<-second).err, context.DeadlineExceeded)
+				resume()
+				return
+			}
+			resume()
+			a, b := <-first, <-second
+			require.NoError(t, a.err)
+			require.NoError(t, b.err)
+			defer a.unsubscribe()
+			defer b.unsubscribe()
+			srv.Notify(promptNotification("s1"))
+			require.Equal(t, "s1", receive(t, a.ch).PromptNotification.GetSession())
+			require.Equal(t, "s1", receive(t, b.ch).PromptNotification.GetSession())
+		})
+	}
+}
+
+func TestUnsubscribeTimeout(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	opts := srv.ClientOptions()
+	opts.CallTimeout = 50 * time.Millisecond
+	c, err := client.NewWithOptions("test", opts)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, unsubscribe, err := c.Subscribe(context.Background(), &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+	})
+	require.NoError(t, err)
+
+	// A hung iTerm2 holds up unsubscribing for CallTimeout at most.
+	resume := srv.Stall()
+	defer resume()
+	start := time.Now()
+	unsubscribe()
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestSubscribeSessionEvents(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.ClientOptions())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ch, unsubscribe, err := c.Subscribe(context.Background(), &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_NEW_SESSION.Enum(),
+	})
+	require.NoError(t, err)
+	defer unsubscribe()
+
+	resp, err := c.Call(&api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
+			CreateTabRequest: &api.CreateTabRequest{},
+		},
+	})
+	require.NoError(t, err)
+	n := receive(t, ch)
+	require.Equal(t, resp.GetCreateTabResponse().GetSessionId(), n.NewSessionNotification.GetSessionId())
+}
+
+func TestSubscribeSlowConsumer(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.ClientOptions())
+	require.NoError(t, err)
+	defer c.Close()
+
+	// Nobody reads from ch, which must not hold up RPCs.
+	ch, unsubscribe, err := c.Subscribe(context.Background(), &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+	})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		srv.Notify(promptNotification(fmt.Sprintf("s%d", i)))
+	}
+	listSessions(t, c)
+
+	require.Equal(t, "s0", receive(t, ch).PromptNotification.GetSession())
+	unsubscribe()
+}
+
+func TestSubscribeConnectionLost(t *testing.T) {
+	for _, reconnect := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reconnect=%v", reconnect), func(t *testing.T) {
+			srv := iterm2test.NewServer()
+			defer srv.Close()
+			opts := srv.ClientOptions()
+			opts.Reconnect = reconnect
+			c, err := client.NewWithOptions("test", opts)
+			require.NoError(t, err)
+			defer c.Close()
+
+			ch, unsubscribe, err := c.Subscribe(context.Background(), &api.NotificationRequest{
+				NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+			})
+			require.NoError(t, err)
+			defer unsubscribe()
+
+			srv.DropConnections()
+			if !reconnect {
+				select {
+				case _, ok := <-ch:
+					require.False(t, ok)
+				case <-time.After(5 * time.Second):
+					t.Fatal("channel was not closed")
+				}
+				return
+			}
+
+			// The subscription is renewed on the new connection.
+			require.Eventually(t, func() bool {
+				srv.Notify(promptNotification("s1"))
+				select {
+				case n := <-ch:
+					return n.PromptNotification.GetSession() == "s1"
+				case <-time.After(50 * time.Millisecond):
+					return false
+				}
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andybrewer/mack"
+)
+
+// CookieProvider supplies the cookie and key that authenticate a client with
+// iTerm2. See https://iterm2.com/python-api-auth.html
+type CookieProvider interface {
+	CookieAndKey(appName string) (cookie, key string, err error)
+}
+
+// AppleScriptCookie requests a new cookie and key from iTerm2 via AppleScript.
+// This is the default provider.
+type AppleScriptCookie struct{}
+
+func (AppleScriptCookie) CookieAndKey(appName string) (string, string, error) {
+	resp, err := mack.Tell("iTerm2", fmt.Sprintf("request cookie and key for app named %q", appName))
+	if err != nil {
+		return "", "", fmt.Errorf("AppleScript/tell: %w", err)
+	}
+	fields := strings.Fields(resp)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("incorrect field format: %q", resp)
+	}
+	return fields[0], fields[1], nil
+}
+
+// EnvCookie reads the cookie and key from the ITERM2_COOKIE and ITERM2_KEY
+// environment variables. iTerm2 sets these in scripts that it launches, and
+// wrappers can set them to pass pre-fetched credentials.
+type EnvCookie struct{}
+
+func (EnvCookie) CookieAndKey(appName string) (string, string, error) {
+	cookie := os.Getenv("ITERM2_COOKIE")
+	if cookie == "" {
+		return "", "", errors.New("ITERM2_COOKIE is not set")
+	}
+	return cookie, os.Getenv("ITERM2_KEY"), nil
+}
+
+// StaticCookie is a fixed cookie and key.
+type StaticCookie struct {
+	Cookie string
+	Key    string
+}
+
+func (s StaticCookie) CookieAndKey(appName string) (string, string, error) {
+	return s.Cookie, s.Key, nil
+}
@@ -0,0 +1,332 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxQueuedNotifications bounds how far a subscriber may fall behind. Past
+// this, its oldest notifications are dropped.
+const maxQueuedNotifications = 10000
+
+// Subscribe asks iTerm2 for the notifications described by req and returns a
+// channel that receives them. The Subscribe field of req is ignored.
+//
+// Call unsubscribe when done. The channel is closed after unsubscribing, when
+// the client is closed, or when the connection is lost without Reconnect.
+//
+// Notifications are queued per subscriber, so a slow consumer never holds up
+// other subscribers or RPC responses.
+func (c *Client) Subscribe(ctx context.Context, req *api.NotificationRequest) (<-chan *api.Notification, func(), error) {
+	req = proto.Clone(req).(*api.NotificationRequest)
+	req.Subscribe = proto.Bool(true)
+	key, err := subscriptionKey(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub := &subscriber{
+		key:  key,
+		req:  req,
+		ch:   make(chan *api.Notification),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	// iTerm2 rejects duplicate subscriptions, so only the first subscriber
+	// for a key subscribes with iTerm2. The others wait for its answer.
+	shared, first, err := c.join(ctx, sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if first {
+		resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+			Submessage: &api.ClientOriginatedMessage_NotificationRequest{
+				NotificationRequest: req,
+			},
+		})
+		if err == nil {
+			status := resp.GetNotificationResponse().GetStatus()
+			if status != api.NotificationResponse_OK && status != api.NotificationResponse_ALREADY_SUBSCRIBED {
+				err = fmt.Errorf("unexpected status subscribing to %s: %s", req.GetNotificationType(), status)
+			}
+		}
+		c.mu.Lock()
+		shared.err = err
+		if err != nil {
+			delete(c.subscribers, sub)
+			if c.subscriptions[key] == shared {
+				delete(c.subscriptions, key)
+			}
+		}
+		c.mu.Unlock()
+		close(shared.subscribed)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		select {
+		case <-shared.subscribed:
+		case <-ctx.Done():
+			c.unsubscribe(sub)
+			return nil, nil, ctx.Err()
+		}
+		if shared.err != nil {
+			c.mu.Lock()
+			delete(c.subscribers, sub)
+			c.mu.Unlock()
+			return nil, nil, shared.err
+		}
+	}
+
+	go sub.pump()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() { c.unsubscribe(sub) })
+	}
+	return sub.ch, unsubscribe, nil
+}
+
+// join adds sub to the subscribers, and returns the subscription with
+// iTerm2 it shares with the other subscribers for its key. If sub is the
+// first, the subscription is new and sub must subscribe with iTerm2. join
+// waits for an earlier subscription for the key to be unsubscribed first.
+func (c *Client) join(ctx context.Context, sub *subscriber) (*subscription, bool, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, false, ErrClosed
+		}
+		s, ok := c.subscriptions[sub.key]
+		if ok && s.unsubscribed != nil {
+			c.mu.Unlock()
+			select {
+			case <-s.unsubscribed:
+				continue
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+		}
+		if !ok {
+			s = &subscription{subscribed: make(chan struct{})}
+			c.subscriptions[sub.key] = s
+		}
+		c.subscribers[sub] = struct{}{}
+		c.mu.Unlock()
+		return s, !ok, nil
+	}
+}
+
+func (c *Client) unsubscribe(sub *subscriber) {
+	c.mu.Lock()
+	delete(c.subscribers, sub)
+	s, ok := c.subscriptions[sub.key]
+	last := ok && c.subscriberCount(sub.key) == 0
+	if last && c.closed {
+		delete(c.subscriptions, sub.key)
+	}
+	unsubscribe := last && !c.closed
+	if unsubscribe {
+		s.unsubscribed = make(chan struct{})
+	}
+	c.mu.Unlock()
+	sub.stop()
+
+	if !unsubscribe {
+		return
+	}
+	defer func() {
+		c.mu.Lock()
+		delete(c.subscriptions, sub.key)
+		c.mu.Unlock()
+		close(s.unsubscribed)
+	}()
+	req := proto.Clone(sub.req).(*api.NotificationRequest)
+	req.Subscribe = proto.Bool(false)
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.CallTimeout)
+	defer cancel()
+	_, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_NotificationRequest{
+			NotificationRequest: req,
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unsubscribing from %s: %v\n", req.GetNotificationType(), err)
+	}
+}
+
+// subscriberCount must be called with c.mu held.
+func (c *Client) subscriberCount(key string) int {
+	n := 0
+	for sub := range c.subscribers {
+		if sub.key == key {
+			n++
+		}
+	}
+	return n
+}
+
+// dispatch hands a notification to every matching subscriber.
+func (c *Client) dispatch(n *api.Notification) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for sub := range c.subscribers {
+		if notificationMatches(sub.req, n) {
+			sub.push(n)
+		}
+	}
+}
+
+// stopSubscribers closes every subscriber's channel.
+func (c *Client) stopSubscribers() {
+	c.mu.Lock()
+	subs := c.subscribers
+	c.subscribers = map[*subscriber]struct{}{}
+	c.subscriptions = map[string]*subscription{}
+	c.mu.Unlock()
+	for sub := range subs {
+		sub.stop()
+	}
+}
+
+// subscriptionKey identifies a subscription with iTerm2: the request minus
+// the subscribe flag, so that unsubscribing finds the subscription.
+func subscriptionKey(req *api.NotificationRequest) (string, error) {
+	key := proto.Clone(req).(*api.NotificationRequest)
+	key.Subscribe = nil
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// subscription is a subscription with iTerm2, shared by the subscribers
+// for its key.
+type subscription struct {
+	// subscribed is closed once iTerm2 answered the subscribe request. err
+	// is set if it failed.
+	subscribed chan struct{}
+	err        error
+	// unsubscribed is set while the last subscriber unsubscribes from
+	// iTerm2, and closed once it is done.
+	unsubscribed chan struct{}
+}
+
+type subscriber struct {
+	key string
+	req *api.NotificationRequest
+	ch  chan *api.Notification
+
+	mu      sync.Mutex
+	queue   []*api.Notification
+	dropped int
+	stopped bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func (s *subscriber) push(n *api.Notification) {
+	s.mu.Lock()
+	if len(s.queue) >= maxQueuedNotifications {
+		s.queue = s.queue[1:]
+		s.dropped++
+		if s.dropped == 1 {
+			fmt.Fprintf(os.Stderr, "slow subscriber to %s: dropping notifications\n", s.req.GetNotificationType())
+		}
+	}
+	s.queue = append(s.queue, n)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump delivers queued notifications to s.ch until stopped.
+func (s *subscriber) pump() {
+	defer close(s.ch)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		n := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- n:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *subscriber) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.done)
+	}
+}
+
+// notificationMatches reports whether n is one of the notifications requested by req.
+func notificationMatches(req *api.NotificationRequest, n *api.Notification) bool {
+	typ := req.GetNotificationType()
+	session := func(s string) bool {
+		return req.GetSession() == "" || req.GetSession() == "all" || req.GetSession() == s
+	}
+
+	switch {
+	case n.KeystrokeNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_KEYSTROKE && session(n.KeystrokeNotification.GetSession())
+	case n.ScreenUpdateNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_SCREEN_UPDATE && session(n.ScreenUpdateNotification.GetSession())
+	case n.PromptNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_PROMPT && session(n.PromptNotification.GetSession())
+	case n.LocationChangeNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_LOCATION_CHANGE && session(n.LocationChangeNotification.GetSession())
+	case n.CustomEscapeSequenceNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE && session(n.CustomEscapeSequenceNotification.GetSession())
+	case n.NewSessionNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_NEW_SESSION
+	case n.TerminateSessionNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_TERMINATE_SESSION
+	case n.LayoutChangedNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE
+	case n.FocusChangedNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_FOCUS_CHANGE
+	case n.ServerOriginatedRpcNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC
+	case n.BroadcastDomainsChanged != nil:
+		return typ == api.NotificationType_NOTIFY_ON_BROADCAST_CHANGE
+	case n.ProfileChangedNotification != nil:
+		return typ == api.NotificationType_NOTIFY_ON_PROFILE_CHANGE
+	case n.VariableChangedNotification != nil:
+		if typ != api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE {
+			return false
+		}
+		monitor := req.GetVariableMonitorRequest()
+		v := n.VariableChangedNotification
+		return monitor.GetName() == v.GetName() &&
+			monitor.GetScope() == v.GetScope() &&
+			(monitor.GetIdentifier() == "" || monitor.GetIdentifier() == v.GetIdentifier())
+	}
+	return false
+}
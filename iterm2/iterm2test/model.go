@@ -0,0 +1,419 @@
+package iterm2test
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// Window is a snapshot of a window in the fake.
+type Window struct {
+	ID    string
+	Title string
+	Tabs  []Tab
+}
+
+// Tab is a snapshot of a tab in the fake.
+type Tab struct {
+	ID    string
+	Title string
+	// SessionIDs lists the tab's sessions in layout order.
+	SessionIDs []string
+}
+
+// Session is a snapshot of a session in the fake.
+type Session struct {
+	ID       string
+	WindowID string
+	TabID    string
+	Name     string
+	// Text is everything sent to the session with SendTextRequest.
+	Text string
+	// Variables holds JSON encoded variable values, by name.
+	Variables map[string]string
+	// Width and Height are the session's grid size, in cells.
+	Width  int
+	Height int
+	// Exited is whether the session's job has exited, see ExitSession.
+	Exited bool
+	// Restarts counts the RestartSessionRequests that restarted the session.
+	Restarts int
+}
+
+// Windows returns a snapshot of all windows.
+func (s *Server) Windows() []Window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Window
+	for _, w := range s.windows {
+		snap := Window{ID: w.id, Title: w.title}
+		for _, t := range w.tabs {
+			tabSnap := Tab{ID: t.id, Title: t.title}
+			for _, sess := range t.root.sessions() {
+				tabSnap.SessionIDs = append(tabSnap.SessionIDs, sess.id)
+			}
+			snap.Tabs = append(snap.Tabs, tabSnap)
+		}
+		result = append(result, snap)
+	}
+	return result
+}
+
+// Session returns a snapshot of the session with the given id.
+func (s *Server) Session(id string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	return Session{
+		ID:        sess.id,
+		WindowID:  sess.tab.window.id,
+		TabID:     sess.tab.id,
+		Name:      sess.name,
+		Text:      sess.text.String(),
+		Variables: maps.Clone(sess.vars),
+		Width:     sess.width,
+		Height:    sess.height,
+		Exited:    sess.exited,
+		Restarts:  sess.restarts,
+	}, true
+}
+
+// EnableShellIntegration makes the session report a shell prompt, as if iTerm2's
+// shell integration were installed. Tests send the prompt notifications
+// themselves with Notify.
+func (s *Server) EnableShellIntegration(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("no session %q", sessionID)
+	}
+	sess.shellIntegration = true
+	return nil
+}
+
+// ExitSession makes the session's job exit, as if its shell had been told to
+// exit. The session stays open until it is closed or restarted.
+func (s *Server) ExitSession(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("no such session: %s", sessionID)
+	}
+	sess.exited = true
+	return nil
+}
+
+// Print adds text to the session's screen, as if its job had printed it.
+func (s *Server) Print(sessionID, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("no such session: %s", sessionID)
+	}
+	sess.screen.WriteString(text)
+	return nil
+}
+
+// SetVariable sets a session variable, such as jobName, that clients cannot set themselves.
+// The value is JSON encoded.
+func (s *Server) SetVariable(sessionID, name string, value any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("no such session: %s", sessionID)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	sess.vars[name] = string(data)
+	return nil
+}
+
+type window struct {
+	id    string
+	title string
+	tabs  []*tab
+}
+
+type tab struct {
+	id     string
+	title  string
+	window *window
+	root   *node
+}
+
+type session struct {
+	id   string
+	name string
+	tab  *tab
+	text strings.Builder
+	// screen is what the session displays: the text sent to it, along with
+	// what Print added.
+	screen strings.Builder
+	vars   map[string]string
+	// shellIntegration makes GetPromptRequest succeed.
+	shellIntegration bool
+	// width and height are the grid size, in cells.
+	width  int
+	height int
+	// exited is set by ExitSession, and cleared by a restart.
+	exited   bool
+	restarts int
+}
+
+// variable returns the JSON encoded value of a variable, or "null" if it is unset.
+func (s *session) variable(name string) string {
+	switch name {
+	case "id":
+		return jsonString(s.id)
+	case "name":
+		return jsonString(s.name)
+	}
+	if value, ok := s.vars[name]; ok {
+		return value
+	}
+	return "null"
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// node is a split in a tab, mirroring api.SplitTreeNode. If vertical is set,
+// the divider is vertical and the links are laid out left to right.
+// Otherwise they are laid out top to bottom.
+type node struct {
+	vertical bool
+	links    []link
+}
+
+// link holds either a session or a nested node.
+type link struct {
+	session *session
+	node    *node
+}
+
+// sessions returns the sessions under n in layout order.
+func (n *node) sessions() []*session {
+	var result []*session
+	for _, l := range n.links {
+		if l.session != nil {
+			result = append(result, l.session)
+		} else {
+			result = append(result, l.node.sessions()...)
+		}
+	}
+	return result
+}
+
+// find returns the node directly holding sess and its index in that node.
+func (n *node) find(sess *session) (*node, int) {
+	for i, l := range n.links {
+		if l.session == sess {
+			return n, i
+		}
+		if l.node != nil {
+			if parent, j := l.node.find(sess); parent != nil {
+				return parent, j
+			}
+		}
+	}
+	return nil, -1
+}
+
+// split places newSess next to target, like iTerm2 does: next to it in the
+// same node if the divider direction matches, or else in a new nested node
+// that takes target's place.
+func (n *node) split(target, newSess *session, vertical, before bool) {
+	parent, i := n.find(target)
+	if len(parent.links) == 1 {
+		parent.vertical = vertical
+	}
+
+	if parent.vertical == vertical {
+		at := i + 1
+		if before {
+			at = i
+		}
+		parent.links = insert(parent.links, at, link{session: newSess})
+		return
+	}
+
+	child := &node{vertical: vertical, links: []link{{session: target}}}
+	if before {
+		child.links = insert(child.links, 0, link{session: newSess})
+	} else {
+		child.links = append(child.links, link{session: newSess})
+	}
+	parent.links[i] = link{node: child}
+}
+
+// remove deletes sess from the tree, collapsing nodes that are left with fewer than two links.
+func (n *node) remove(sess *session) bool {
+	for i, l := range n.links {
+		if l.session == sess {
+			n.links = append(n.links[:i], n.links[i+1:]...)
+			return true
+		}
+		if l.node != nil && l.node.remove(sess) {
+			switch len(l.node.links) {
+			case 0:
+				n.links = append(n.links[:i], n.links[i+1:]...)
+			case 1:
+				n.links[i] = l.node.links[0]
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) toAPI() *api.SplitTreeNode {
+	result := &api.SplitTreeNode{Vertical: proto.Bool(n.vertical)}
+	for _, l := range n.links {
+		if l.session != nil {
+			result.Links = append(result.Links, &api.SplitTreeNode_SplitTreeLink{
+				Child: &api.SplitTreeNode_SplitTreeLink_Session{
+					Session: &api.SessionSummary{
+						UniqueIdentifier: proto.String(l.session.id),
+						Title:            proto.String(l.session.name),
+						GridSize: &api.Size{
+							Width:  proto.Int32(int32(l.session.width)),
+							Height: proto.Int32(int32(l.session.height)),
+						},
+					},
+				},
+			})
+		} else {
+			result.Links = append(result.Links, &api.SplitTreeNode_SplitTreeLink{
+				Child: &api.SplitTreeNode_SplitTreeLink_Node{Node: l.node.toAPI()},
+			})
+		}
+	}
+	return result
+}
+
+// resize applies the grid sizes in req, which must have the same shape as
+// n, with sizes that add up to the same totals.
+func (n *node) resize(req *api.SplitTreeNode) api.SetTabLayoutResponse_Status {
+	type resize struct {
+		sess          *session
+		width, height int
+	}
+	var resizes []resize
+	var check func(n *node, req *api.SplitTreeNode) api.SetTabLayoutResponse_Status
+	check = func(n *node, req *api.SplitTreeNode) api.SetTabLayoutResponse_Status {
+		if req.GetVertical() != n.vertical || len(req.GetLinks()) != len(n.links) {
+			return api.SetTabLayoutResponse_WRONG_TREE
+		}
+		for i, l := range n.links {
+			reqLink := req.GetLinks()[i]
+			if l.session != nil {
+				summary := reqLink.GetSession()
+				if summary.GetUniqueIdentifier() != l.session.id {
+					return api.SetTabLayoutResponse_WRONG_TREE
+				}
+				size := summary.GetGridSize()
+				if size.GetWidth() <= 0 || size.GetHeight() <= 0 {
+					return api.SetTabLayoutResponse_INVALID_SIZE
+				}
+				resizes = append(resizes, resize{l.session, int(size.GetWidth()), int(size.GetHeight())})
+				continue
+			}
+			if reqLink.GetNode() == nil {
+				return api.SetTabLayoutResponse_WRONG_TREE
+			}
+			if status := check(l.node, reqLink.GetNode()); status != api.SetTabLayoutResponse_OK {
+				return status
+			}
+		}
+		return api.SetTabLayoutResponse_OK
+	}
+	if status := check(n, req); status != api.SetTabLayoutResponse_OK {
+		return status
+	}
+
+	width, height := n.size()
+	reqWidth, reqHeight, ok := gridSize(req)
+	if !ok || reqWidth != width || reqHeight != height {
+		return api.SetTabLayoutResponse_INVALID_SIZE
+	}
+	for _, r := range resizes {
+		r.sess.width, r.sess.height = r.width, r.height
+	}
+	return api.SetTabLayoutResponse_OK
+}
+
+// size returns the grid size of n: the sum of its links along the split,
+// and their size across it.
+func (n *node) size() (width, height int) {
+	for _, l := range n.links {
+		w, h := 0, 0
+		if l.session != nil {
+			w, h = l.session.width, l.session.height
+		} else {
+			w, h = l.node.size()
+		}
+		if n.vertical {
+			width += w
+			height = h
+		} else {
+			width = w
+			height += h
+		}
+	}
+	return width, height
+}
+
+// gridSize is node.size for a requested tree. It reports false if the links
+// do not line up across the split.
+func gridSize(n *api.SplitTreeNode) (width, height int, ok bool) {
+	for i, l := range n.GetLinks() {
+		w, h := 0, 0
+		if sess := l.GetSession(); sess != nil {
+			w, h = int(sess.GetGridSize().GetWidth()), int(sess.GetGridSize().GetHeight())
+		} else if w, h, ok = gridSize(l.GetNode()); !ok {
+			return 0, 0, false
+		}
+		if n.GetVertical() {
+			if i > 0 && h != height {
+				return 0, 0, false
+			}
+			width += w
+			height = h
+		} else {
+			if i > 0 && w != width {
+				return 0, 0, false
+			}
+			width = w
+			height += h
+		}
+	}
+	return width, height, true
+}
+
+func insert(links []link, at int, l link) []link {
+	links = append(links, link{})
+	copy(links[at+1:], links[at:])
+	links[at] = l
+	return links
+}
@@ -0,0 +1,167 @@
+package iterm2test
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// conn is a client connection and the notifications it subscribed to.
+type conn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+	// subs is guarded by Server.mu.
+	subs map[subscription]struct{}
+}
+
+func (c *conn) send(msg *api.ServerOriginatedMessage) error {
+	out, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.BinaryMessage, out)
+}
+
+// subscription identifies a notification subscription the way iTerm2 does:
+// by type, session and, for variable monitors, the monitored variable.
+type subscription struct {
+	typ      api.NotificationType
+	session  string
+	variable string
+	scope    api.VariableScope
+}
+
+func newSubscription(req *api.NotificationRequest) subscription {
+	sub := subscription{typ: req.GetNotificationType(), session: req.GetSession()}
+	if sub.session == "all" {
+		sub.session = ""
+	}
+	if monitor := req.GetVariableMonitorRequest(); monitor != nil {
+		sub.variable = monitor.GetName()
+		sub.scope = monitor.GetScope()
+		sub.session = monitor.GetIdentifier()
+	}
+	return sub
+}
+
+func (sub subscription) matches(n *api.Notification) bool {
+	session := func(id string) bool { return sub.session == "" || sub.session == id }
+	switch {
+	case n.KeystrokeNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_KEYSTROKE && session(n.KeystrokeNotification.GetSession())
+	case n.ScreenUpdateNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_SCREEN_UPDATE && session(n.ScreenUpdateNotification.GetSession())
+	case n.PromptNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_PROMPT && session(n.PromptNotification.GetSession())
+	case n.LocationChangeNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_LOCATION_CHANGE && session(n.LocationChangeNotification.GetSession())
+	case n.CustomEscapeSequenceNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE && session(n.CustomEscapeSequenceNotification.GetSession())
+	case n.NewSessionNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_NEW_SESSION
+	case n.TerminateSessionNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_TERMINATE_SESSION
+	case n.LayoutChangedNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE
+	case n.FocusChangedNotification != nil:
+		return sub.typ == api.NotificationType_NOTIFY_ON_FOCUS_CHANGE
+	case n.VariableChangedNotification != nil:
+		v := n.VariableChangedNotification
+		return sub.typ == api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE &&
+			sub.variable == v.GetName() && sub.scope == v.GetScope() && session(v.GetIdentifier())
+	}
+	return false
+}
+
+func (s *Server) notificationRequest(c *conn, req *api.NotificationRequest) *api.ServerOriginatedMessage {
+	sub := newSubscription(req)
+	_, subscribed := c.subs[sub]
+	status := api.NotificationResponse_OK
+	switch {
+	case req.GetSubscribe() && subscribed:
+		status = api.NotificationResponse_ALREADY_SUBSCRIBED
+	case req.GetSubscribe():
+		c.subs[sub] = struct{}{}
+	case !subscribed:
+		status = api.NotificationResponse_NOT_SUBSCRIBED
+	default:
+		delete(c.subs, sub)
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_NotificationResponse{
+			NotificationResponse: &api.NotificationResponse{Status: &status},
+		},
+	}
+}
+
+// Notify sends n to every connection subscribed to it, like iTerm2 would when
+// the corresponding event happens. The fake sends new session, terminate
+// session and layout change notifications on its own.
+func (s *Server) Notify(n *api.Notification) {
+	s.mu.Lock()
+	s.outbox = append(s.outbox, n)
+	s.mu.Unlock()
+	s.flush()
+}
+
+// notify queues n until the current request has been answered. It must be
+// called with s.mu held.
+func (s *Server) notify(n *api.Notification) {
+	s.outbox = append(s.outbox, n)
+}
+
+func (s *Server) notifyNewSession(sess *session) {
+	s.notify(&api.Notification{
+		NewSessionNotification: &api.NewSessionNotification{SessionId: proto.String(sess.id)},
+	})
+	s.layoutChanged = true
+}
+
+func (s *Server) notifyTerminateSession(sess *session) {
+	s.notify(&api.Notification{
+		TerminateSessionNotification: &api.TerminateSessionNotification{SessionId: proto.String(sess.id)},
+	})
+	s.layoutChanged = true
+}
+
+// flush sends queued notifications, followed by a single layout change for
+// everything that happened since the last flush.
+func (s *Server) flush() {
+	type delivery struct {
+		c   *conn
+		msg *api.ServerOriginatedMessage
+	}
+	s.mu.Lock()
+	if s.layoutChanged {
+		s.outbox = append(s.outbox, &api.Notification{
+			LayoutChangedNotification: &api.LayoutChangedNotification{ListSessionsResponse: s.layout()},
+		})
+		s.layoutChanged = false
+	}
+	var deliveries []delivery
+	for _, n := range s.outbox {
+		msg := &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_Notification{Notification: n},
+		}
+		for _, c := range s.conns {
+			for sub := range c.subs {
+				if sub.matches(n) {
+					deliveries = append(deliveries, delivery{c: c, msg: msg})
+					break
+				}
+			}
+		}
+	}
+	s.outbox = nil
+	s.mu.Unlock()
+
+	for _, d := range deliveries {
+		// A failed write means the connection is going away; its reader
+		// notices and cleans up.
+		_ = d.c.send(d.msg)
+	}
+}
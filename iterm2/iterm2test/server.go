@@ -0,0 +1,679 @@
+// Package iterm2test provides a fake iTerm2 for testing code that talks to
+// iTerm2, in the spirit of net/http/httptest.
+//
+// The fake speaks iTerm2's websocket protocol (see api/api.proto) over a unix
+// socket or TCP, and keeps an in-memory model of windows, tabs, split panes,
+// sessions and session variables. It answers the subset of requests used in
+// this repo; any other request gets an error response. Clients can subscribe
+// to notifications, which tests send with Server.Notify.
+//
+//	srv := iterm2test.NewServer()
+//	defer srv.Close()
+//	app, err := iterm2.NewAppWithOptions("test", srv.ClientOptions())
+package iterm2test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/pglass/iterm-tool/iterm2/api"
+	"github.com/pglass/iterm-tool/iterm2/client"
+	"google.golang.org/protobuf/proto"
+)
+
+// New tabs get a single session of this grid size. Splits divide it.
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// Server is a fake iTerm2 listening on a unix socket, or on TCP like
+// iTerm2's legacy port.
+type Server struct {
+	// SocketPath is the unix socket the server listens on, if any.
+	SocketPath string
+	// Addr is the TCP address the server listens on, if any.
+	Addr string
+
+	dir      string
+	listener net.Listener
+	server   *http.Server
+	upgrader websocket.Upgrader
+
+	done chan struct{}
+
+	mu       sync.Mutex
+	conns    map[*websocket.Conn]*conn
+	header   http.Header
+	stalled  chan struct{}
+	windows  []*window
+	sessions map[string]*session
+	nextID   int
+
+	// Notifications waiting to be sent once the current request is answered.
+	outbox        []*api.Notification
+	layoutChanged bool
+}
+
+// NewServer starts a fake iTerm2 with no windows, listening on a unix socket.
+// Callers must call Close when done. It panics if it cannot listen, like
+// httptest.NewServer.
+func NewServer() *Server {
+	// Unix socket paths are limited to ~100 bytes, so stay clear of deep test directories.
+	dir, err := os.MkdirTemp("", "iterm2test")
+	if err != nil {
+		panic(fmt.Sprintf("iterm2test: %v", err))
+	}
+	socketPath := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		panic(fmt.Sprintf("iterm2test: failed to listen on %s: %v", socketPath, err))
+	}
+	s := newServer(listener)
+	s.SocketPath = socketPath
+	s.dir = dir
+	return s
+}
+
+// NewTCPServer is like NewServer, but listens on a local TCP port.
+func NewTCPServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("iterm2test: failed to listen: %v", err))
+	}
+	s := newServer(listener)
+	s.Addr = listener.Addr().String()
+	return s
+}
+
+func newServer(listener net.Listener) *Server {
+	s := &Server{
+		listener: listener,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{"api.iterm2.com"},
+			CheckOrigin:  func(*http.Request) bool { return true },
+		},
+		done:     make(chan struct{}),
+		conns:    map[*websocket.Conn]*conn{},
+		sessions: map[string]*session{},
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serveHTTP)}
+	go s.server.Serve(listener)
+	return s
+}
+
+// ClientOptions returns options for client.NewWithOptions (or
+// iterm2.NewAppWithOptions) that connect to this server.
+func (s *Server) ClientOptions() client.Options {
+	return client.Options{
+		SocketPath: s.SocketPath,
+		TCPAddress: s.Addr,
+		Cookies: client.StaticCookie{
+			Cookie: "iterm2test-cookie",
+			Key:    "iterm2test-key",
+		},
+	}
+}
+
+// Header returns the handshake headers of the most recent connection.
+func (s *Server) Header() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.header.Clone()
+}
+
+// Stall makes the server stop answering requests, like a hung iTerm2, until
+// resume is called. Requests received while stalled are answered on resume.
+func (s *Server) Stall() (resume func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stalled := make(chan struct{})
+	s.stalled = stalled
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stalled == stalled {
+			s.stalled = nil
+		}
+		close(stalled)
+	}
+}
+
+// DropConnections closes all client connections, like iTerm2 restarting,
+// but keeps listening for new ones.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ws := range s.conns {
+		ws.Close()
+	}
+}
+
+// Connections returns the number of clients connected.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Close stops the server and drops all connections.
+func (s *Server) Close() error {
+	close(s.done)
+	err := s.server.Close()
+	s.mu.Lock()
+	for ws := range s.conns {
+		ws.Close()
+	}
+	s.mu.Unlock()
+	if s.dir != "" {
+		err = errors.Join(err, os.RemoveAll(s.dir))
+	}
+	return err
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{ws: ws, subs: map[subscription]struct{}{}}
+	s.mu.Lock()
+	s.conns[ws] = c
+	s.header = r.Header.Clone()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, ws)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		stalled := s.stalled
+		s.mu.Unlock()
+		if stalled != nil {
+			select {
+			case <-stalled:
+			case <-s.done:
+				return
+			}
+		}
+
+		var req api.ClientOriginatedMessage
+		var resp *api.ServerOriginatedMessage
+		if err := proto.Unmarshal(data, &req); err != nil {
+			resp = errorResponse("malformed request: %v", err)
+		} else {
+			resp = s.handle(c, &req)
+		}
+		resp.Id = req.Id
+		if err := c.send(resp); err != nil {
+			return
+		}
+		s.flush()
+	}
+}
+
+func errorResponse(format string, args ...any) *api.ServerOriginatedMessage {
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_Error{
+			Error: fmt.Sprintf(format, args...),
+		},
+	}
+}
+
+func (s *Server) handle(c *conn, req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch sub := req.Submessage.(type) {
+	case *api.ClientOriginatedMessage_CreateTabRequest:
+		return s.createTab(sub.CreateTabRequest)
+	case *api.ClientOriginatedMessage_SplitPaneRequest:
+		return s.splitPane(sub.SplitPaneRequest)
+	case *api.ClientOriginatedMessage_ListSessionsRequest:
+		return s.listSessions()
+	case *api.ClientOriginatedMessage_SendTextRequest:
+		return s.sendText(sub.SendTextRequest)
+	case *api.ClientOriginatedMessage_VariableRequest:
+		return s.variable(sub.VariableRequest)
+	case *api.ClientOriginatedMessage_CloseRequest:
+		return s.close(sub.CloseRequest)
+	case *api.ClientOriginatedMessage_InvokeFunctionRequest:
+		return s.invokeFunction(sub.InvokeFunctionRequest)
+	case *api.ClientOriginatedMessage_GetBufferRequest:
+		return s.getBuffer(sub.GetBufferRequest)
+	case *api.ClientOriginatedMessage_GetPromptRequest:
+		return s.getPrompt(sub.GetPromptRequest)
+	case *api.ClientOriginatedMessage_NotificationRequest:
+		return s.notificationRequest(c, sub.NotificationRequest)
+	case *api.ClientOriginatedMessage_SetTabLayoutRequest:
+		return s.setTabLayout(sub.SetTabLayoutRequest)
+	case *api.ClientOriginatedMessage_RestartSessionRequest:
+		return s.restartSession(sub.RestartSessionRequest)
+	default:
+		return errorResponse("iterm2test: unsupported request %T", sub)
+	}
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s%d", prefix, s.nextID)
+}
+
+func (s *Server) newSession(t *tab) *session {
+	sess := &session{
+		id:  s.newID("session-"),
+		tab: t,
+		vars: map[string]string{
+			"jobName": `"bash"`,
+		},
+	}
+	s.sessions[sess.id] = sess
+	return sess
+}
+
+func (s *Server) findWindow(id string) *window {
+	for _, w := range s.windows {
+		if w.id == id {
+			return w
+		}
+	}
+	return nil
+}
+
+func (s *Server) findTab(id string) *tab {
+	for _, w := range s.windows {
+		for _, t := range w.tabs {
+			if t.id == id {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) createTab(req *api.CreateTabRequest) *api.ServerOriginatedMessage {
+	var w *window
+	if req.WindowId == nil {
+		w = &window{id: s.newID("window-")}
+		s.windows = append(s.windows, w)
+	} else if w = s.findWindow(req.GetWindowId()); w == nil {
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_CreateTabResponse{
+				CreateTabResponse: &api.CreateTabResponse{
+					Status: api.CreateTabResponse_INVALID_WINDOW_ID.Enum(),
+				},
+			},
+		}
+	}
+
+	// Tab ids are numeric in iTerm2. CreateTabResponse carries them as an int.
+	s.nextID++
+	tabID := s.nextID
+	t := &tab{id: strconv.Itoa(tabID), window: w, root: &node{}}
+	sess := s.newSession(t)
+	sess.width, sess.height = defaultWidth, defaultHeight
+	t.root.links = []link{{session: sess}}
+	w.tabs = append(w.tabs, t)
+	s.notifyNewSession(sess)
+
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_CreateTabResponse{
+			CreateTabResponse: &api.CreateTabResponse{
+				Status:    api.CreateTabResponse_OK.Enum(),
+				WindowId:  proto.String(w.id),
+				TabId:     proto.Int32(int32(tabID)),
+				SessionId: proto.String(sess.id),
+			},
+		},
+	}
+}
+
+func (s *Server) splitPane(req *api.SplitPaneRequest) *api.ServerOriginatedMessage {
+	resp := &api.SplitPaneResponse{}
+	target, ok := s.sessions[req.GetSession()]
+	if !ok {
+		resp.Status = api.SplitPaneResponse_SESSION_NOT_FOUND.Enum()
+	} else {
+		sess := s.newSession(target.tab)
+		vertical := req.GetSplitDirection() == api.SplitPaneRequest_VERTICAL
+		target.tab.root.split(target, sess, vertical, req.GetBefore())
+		// The new session takes half of the target's space.
+		sess.width, sess.height = target.width, target.height
+		if vertical {
+			sess.width = target.width / 2
+			target.width -= sess.width
+		} else {
+			sess.height = target.height / 2
+			target.height -= sess.height
+		}
+		s.notifyNewSession(sess)
+		resp.Status = api.SplitPaneResponse_OK.Enum()
+		resp.SessionId = []string{sess.id}
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_SplitPaneResponse{SplitPaneResponse: resp},
+	}
+}
+
+func (s *Server) setTabLayout(req *api.SetTabLayoutRequest) *api.ServerOriginatedMessage {
+	status := api.SetTabLayoutResponse_BAD_TAB_ID
+	if t := s.findTab(req.GetTabId()); t != nil {
+		status = t.root.resize(req.GetRoot())
+	}
+	if status == api.SetTabLayoutResponse_OK {
+		s.layoutChanged = true
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_SetTabLayoutResponse{
+			SetTabLayoutResponse: &api.SetTabLayoutResponse{Status: status.Enum()},
+		},
+	}
+}
+
+func (s *Server) listSessions() *api.ServerOriginatedMessage {
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_ListSessionsResponse{ListSessionsResponse: s.layout()},
+	}
+}
+
+func (s *Server) layout() *api.ListSessionsResponse {
+	resp := &api.ListSessionsResponse{}
+	for _, w := range s.windows {
+		apiWindow := &api.ListSessionsResponse_Window{WindowId: proto.String(w.id)}
+		for _, t := range w.tabs {
+			apiWindow.Tabs = append(apiWindow.Tabs, &api.ListSessionsResponse_Tab{
+				TabId: proto.String(t.id),
+				Root:  t.root.toAPI(),
+			})
+		}
+		resp.Windows = append(resp.Windows, apiWindow)
+	}
+	return resp
+}
+
+func (s *Server) sendText(req *api.SendTextRequest) *api.ServerOriginatedMessage {
+	resp := &api.SendTextResponse{Status: api.SendTextResponse_OK.Enum()}
+	if sess, ok := s.sessions[req.GetSession()]; ok {
+		sess.text.WriteString(req.GetText())
+		sess.screen.WriteString(req.GetText())
+	} else {
+		resp.Status = api.SendTextResponse_SESSION_NOT_FOUND.Enum()
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_SendTextResponse{SendTextResponse: resp},
+	}
+}
+
+// getBuffer pretends that the text sent to a session is what it displays,
+// along with what Print added. Lines longer than the session is wide wrap.
+// Lines are never lost from the scrollback, and the cursor is at the end of
+// the text. Only trailing_lines ranges are supported.
+func (s *Server) getBuffer(req *api.GetBufferRequest) *api.ServerOriginatedMessage {
+	resp := &api.GetBufferResponse{Status: api.GetBufferResponse_OK.Enum()}
+	sess, ok := s.sessions[req.GetSession()]
+	n := int(req.GetLineRange().GetTrailingLines())
+	switch {
+	case !ok:
+		resp.Status = api.GetBufferResponse_SESSION_NOT_FOUND.Enum()
+	case n <= 0:
+		resp.Status = api.GetBufferResponse_INVALID_LINE_RANGE.Enum()
+	default:
+		var lines []*api.LineContents
+		for _, text := range strings.Split(sess.screen.String(), "\n") {
+			for len(text) > sess.width {
+				lines = append(lines, &api.LineContents{
+					Text:         proto.String(text[:sess.width]),
+					Continuation: api.LineContents_CONTINUATION_SOFT_EOL.Enum(),
+				})
+				text = text[sess.width:]
+			}
+			lines = append(lines, &api.LineContents{
+				Text:         proto.String(text),
+				Continuation: api.LineContents_CONTINUATION_HARD_EOL.Enum(),
+			})
+		}
+		last := lines[len(lines)-1]
+		cursor := &api.Coord{
+			X: proto.Int32(int32(len(last.GetText()))),
+			Y: proto.Int64(int64(len(lines) - 1)),
+		}
+		// The cursor's line is only part of the buffer once it holds text.
+		if last.GetText() == "" {
+			lines = lines[:len(lines)-1]
+		}
+		first := max(0, len(lines)-n)
+		resp.Cursor = cursor
+		resp.WindowedCoordRange = &api.WindowedCoordRange{
+			CoordRange: &api.CoordRange{
+				Start: &api.Coord{X: proto.Int32(0), Y: proto.Int64(int64(first))},
+				End:   cursor,
+			},
+		}
+		resp.Contents = lines[first:]
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_GetBufferResponse{GetBufferResponse: resp},
+	}
+}
+
+func (s *Server) getPrompt(req *api.GetPromptRequest) *api.ServerOriginatedMessage {
+	resp := &api.GetPromptResponse{Status: api.GetPromptResponse_OK.Enum()}
+	sess, ok := s.sessions[req.GetSession()]
+	switch {
+	case !ok:
+		resp.Status = api.GetPromptResponse_SESSION_NOT_FOUND.Enum()
+	case !sess.shellIntegration:
+		resp.Status = api.GetPromptResponse_PROMPT_UNAVAILABLE.Enum()
+	default:
+		resp.PromptState = api.GetPromptResponse_EDITING.Enum()
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_GetPromptResponse{GetPromptResponse: resp},
+	}
+}
+
+func (s *Server) variable(req *api.VariableRequest) *api.ServerOriginatedMessage {
+	respond := func(resp *api.VariableResponse) *api.ServerOriginatedMessage {
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_VariableResponse{VariableResponse: resp},
+		}
+	}
+
+	scope, ok := req.Scope.(*api.VariableRequest_SessionId)
+	if !ok {
+		return errorResponse("iterm2test: only session variables are supported")
+	}
+	sess, ok := s.sessions[scope.SessionId]
+	if !ok {
+		return respond(&api.VariableResponse{Status: api.VariableResponse_SESSION_NOT_FOUND.Enum()})
+	}
+
+	for _, set := range req.GetSet() {
+		if !strings.HasPrefix(set.GetName(), "user.") {
+			return respond(&api.VariableResponse{Status: api.VariableResponse_INVALID_NAME.Enum()})
+		}
+	}
+	for _, set := range req.GetSet() {
+		sess.vars[set.GetName()] = set.GetValue()
+	}
+
+	resp := &api.VariableResponse{Status: api.VariableResponse_OK.Enum()}
+	for _, name := range req.GetGet() {
+		resp.Values = append(resp.Values, sess.variable(name))
+	}
+	return respond(resp)
+}
+
+func (s *Server) close(req *api.CloseRequest) *api.ServerOriginatedMessage {
+	resp := &api.CloseResponse{}
+	status := func(found bool) {
+		if found {
+			resp.Statuses = append(resp.Statuses, api.CloseResponse_OK)
+		} else {
+			resp.Statuses = append(resp.Statuses, api.CloseResponse_NOT_FOUND)
+		}
+	}
+
+	switch target := req.Target.(type) {
+	case *api.CloseRequest_Windows:
+		for _, id := range target.Windows.GetWindowIds() {
+			w := s.findWindow(id)
+			if w != nil {
+				// Closing the last session in a tab removes it from w.tabs.
+				for _, t := range slices.Clone(w.tabs) {
+					s.closeTab(t)
+				}
+			}
+			status(w != nil)
+		}
+	case *api.CloseRequest_Tabs:
+		for _, id := range target.Tabs.GetTabIds() {
+			t := s.findTab(id)
+			if t != nil {
+				s.closeTab(t)
+			}
+			status(t != nil)
+		}
+	case *api.CloseRequest_Sessions:
+		for _, id := range target.Sessions.GetSessionIds() {
+			sess, ok := s.sessions[id]
+			if ok {
+				s.closeSession(sess)
+			}
+			status(ok)
+		}
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_CloseResponse{CloseResponse: resp},
+	}
+}
+
+// restartSession starts a session over with an empty screen, as if its
+// command had been started again.
+func (s *Server) restartSession(req *api.RestartSessionRequest) *api.ServerOriginatedMessage {
+	resp := &api.RestartSessionResponse{Status: api.RestartSessionResponse_OK.Enum()}
+	sess, ok := s.sessions[req.GetSessionId()]
+	switch {
+	case !ok:
+		resp.Status = api.RestartSessionResponse_SESSION_NOT_FOUND.Enum()
+	case req.GetOnlyIfExited() && !sess.exited:
+		resp.Status = api.RestartSessionResponse_SESSION_NOT_RESTARTABLE.Enum()
+	default:
+		sess.text.Reset()
+		sess.screen.Reset()
+		sess.exited = false
+		sess.restarts++
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_RestartSessionResponse{RestartSessionResponse: resp},
+	}
+}
+
+func (s *Server) closeTab(t *tab) {
+	for _, sess := range t.root.sessions() {
+		s.closeSession(sess)
+	}
+}
+
+// closeSession removes the session, along with its tab and window if they become empty.
+func (s *Server) closeSession(sess *session) {
+	delete(s.sessions, sess.id)
+	s.notifyTerminateSession(sess)
+	t := sess.tab
+	t.root.remove(sess)
+	if len(t.root.links) > 0 {
+		return
+	}
+
+	w := t.window
+	w.tabs = slices.DeleteFunc(w.tabs, func(other *tab) bool { return other == t })
+	if len(w.tabs) > 0 {
+		return
+	}
+	s.windows = slices.DeleteFunc(s.windows, func(other *window) bool { return other == w })
+}
+
+// invocationRe matches the function calls sent by the iterm2 package,
+// like `iterm2.set_name(name: "value")`.
+var invocationRe = regexp.MustCompile(`^iterm2\.(\w+)\((\w+): ("(?:[^"\\]|\\.)*")\)$`)
+
+func (s *Server) invokeFunction(req *api.InvokeFunctionRequest) *api.ServerOriginatedMessage {
+	fail := func(status api.InvokeFunctionResponse_Status, reason string) *api.ServerOriginatedMessage {
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_InvokeFunctionResponse{
+				InvokeFunctionResponse: &api.InvokeFunctionResponse{
+					Disposition: &api.InvokeFunctionResponse_Error_{
+						Error: &api.InvokeFunctionResponse_Error{
+							Status:      status.Enum(),
+							ErrorReason: proto.String(reason),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	method, ok := req.Context.(*api.InvokeFunctionRequest_Method_)
+	if !ok {
+		return fail(api.InvokeFunctionResponse_REQUEST_MALFORMED, "iterm2test: only method invocations are supported")
+	}
+	m := invocationRe.FindStringSubmatch(req.GetInvocation())
+	if m == nil {
+		return fail(api.InvokeFunctionResponse_REQUEST_MALFORMED, fmt.Sprintf("iterm2test: cannot parse invocation %q", req.GetInvocation()))
+	}
+	function, arg := m[1], m[3]
+	if unquoted, err := strconv.Unquote(arg); err == nil {
+		arg = unquoted
+	}
+
+	receiver := method.Method.GetReceiver()
+	switch function {
+	case "set_name":
+		sess, ok := s.sessions[receiver]
+		if !ok {
+			return fail(api.InvokeFunctionResponse_INVALID_ID, "no such session: "+receiver)
+		}
+		sess.name = arg
+	case "set_title":
+		if w := s.findWindow(receiver); w != nil {
+			w.title = arg
+		} else if t := s.findTab(receiver); t != nil {
+			t.title = arg
+		} else {
+			return fail(api.InvokeFunctionResponse_INVALID_ID, "no such window or tab: "+receiver)
+		}
+	default:
+		return fail(api.InvokeFunctionResponse_FAILED, "iterm2test: unsupported function "+function)
+	}
+
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_InvokeFunctionResponse{
+			InvokeFunctionResponse: &api.InvokeFunctionResponse{
+				Disposition: &api.InvokeFunctionResponse_Success_{
+					Success: &api.InvokeFunctionResponse_Success{
+						JsonResult: proto.String("null"),
+					},
+				},
+			},
+		},
+	}
+}
@@ -8,6 +8,7 @@
 package scaffold
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pglass/iterm-tool/iterm2"
@@ -22,7 +23,7 @@ type WindowSpec struct {
 
 // Run takes a window spec and creates a new iTerm2 session and uses it
 // to create a new window with the given specs.
-func Run(appName string, w WindowSpec) error {
+func Run(ctx context.Context, appName string, w WindowSpec) error {
 	if w.Title == "" {
 		return fmt.Errorf("window must have a title")
 	}
@@ -34,11 +35,11 @@ func Run(appName string, w WindowSpec) error {
 		return fmt.Errorf("iterm2.NewApp: %w", err)
 	}
 	defer app.Close()
-	window, err := app.CreateWindow(nil)
+	window, err := app.CreateWindow(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("app.CreateWindow: %w", err)
 	}
-	err = window.SetTitle(w.Title)
+	err = window.SetTitle(ctx, w.Title)
 	if err != nil {
 		return fmt.Errorf("window.SetTitle: %w", err)
 	}
@@ -46,78 +47,78 @@ func Run(appName string, w WindowSpec) error {
 	for i, ts := range w.Tabs {
 		var tab iterm2.Tab
 		if i == 0 {
-			tabs, err := window.ListTabs()
+			tabs, err := window.ListTabs(ctx)
 			if err != nil {
 				return fmt.Errorf("window.ListTabs: %w", err)
 			}
 			tab = tabs[0]
 		} else {
-			tab, err = window.CreateTab()
+			tab, err = window.CreateTab(ctx)
 			if err != nil {
 				return fmt.Errorf("window.CreateTab: %w", err)
 			}
 		}
 		ts := ts
-		eg.Go(func() error { return createTab(tab, ts) })
+		eg.Go(func() error { return createTab(ctx, tab, ts) })
 	}
 	err = eg.Wait()
 	if err != nil {
 		return fmt.Errorf("createTab: %w", err)
 	}
-	windowTabs, err := window.ListTabs()
+	windowTabs, err := window.ListTabs(ctx)
 	if err != nil {
 		return err
 	}
-	ss, err := windowTabs[0].ListSessions()
+	ss, err := windowTabs[0].ListSessions(ctx)
 	if err != nil {
 		return fmt.Errorf("first tab sessions: %w", err)
 	}
-	err = ss[0].Activate(true, true)
+	err = ss[0].Activate(ctx, true, true)
 	if err != nil {
 		return fmt.Errorf("session.Activate: %w", err)
 	}
 	return nil
 }
 
-func createTab(tab iterm2.Tab, ts TabSpec) error {
-	err := tab.SetTitle(ts.Title)
+func createTab(ctx context.Context, tab iterm2.Tab, ts TabSpec) error {
+	err := tab.SetTitle(ctx, ts.Title)
 	if err != nil {
 		return fmt.Errorf("tab.SetTitle: %w", err)
 	}
-	sessions, err := tab.ListSessions()
+	sessions, err := tab.ListSessions(ctx)
 	if err != nil {
 		return fmt.Errorf("tab.ListSessions: %w", err)
 	}
 	sesh := sessions[0]
 	if ts.Dir != "" {
-		err = sesh.SendText(fmt.Sprintf("cd %v\n", ts.Dir))
+		err = sesh.SendText(ctx, fmt.Sprintf("cd %v\n", ts.Dir))
 		if err != nil {
 			return fmt.Errorf("error changing directory: %w", err)
 		}
 	}
 	if ts.Env != nil {
 		for _, e := range ts.Env.GetEnv() {
-			err = sesh.SendText(fmt.Sprintf("export %s\n", e))
+			err = sesh.SendText(ctx, fmt.Sprintf("export %s\n", e))
 			if err != nil {
 				return fmt.Errorf("error exporting env: %w", err)
 			}
 		}
 	}
 	if ts.OnCreate != nil {
-		err = ts.OnCreate(sesh)
+		err = ts.OnCreate(ctx, sesh)
 		if err != nil {
 			return err
 		}
 	}
 	if ts.Pane != nil {
-		pane, err := sesh.SplitPane(iterm2.SplitPaneOptions{
+		pane, err := sesh.SplitPane(ctx, iterm2.SplitPaneOptions{
 			Vertical: true,
 		})
 		if err != nil {
 			return fmt.Errorf("sesh.SplitPane: %w", err)
 		}
 		if ts.Pane.OnCreate != nil {
-			err = ts.Pane.OnCreate(pane)
+			err = ts.Pane.OnCreate(ctx, pane)
 			if err != nil {
 				return fmt.Errorf("pane.OnCreate: %w", err)
 			}
@@ -152,11 +153,11 @@ type TabSpec struct {
 	Title    string
 	Dir      string
 	Env      EnvGetter
-	OnCreate func(s iterm2.Session) error
+	OnCreate func(ctx context.Context, s iterm2.Session) error
 	Pane     *PaneSpec
 }
 
 // PaneSpec specifies a vertical right pane within a tab
 type PaneSpec struct {
-	OnCreate func(s iterm2.Session) error
+	OnCreate func(ctx context.Context, s iterm2.Session) error
 }
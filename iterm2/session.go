@@ -1,21 +1,61 @@
 package iterm2
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/pglass/iterm-tool/iterm2/api"
 	"github.com/pglass/iterm-tool/iterm2/client"
+	"google.golang.org/protobuf/proto"
 )
 
 // Session represents an iTerm2 Session which is a pane
 // within a Tab where the terminal is active
 type Session interface {
-	SendText(s string) error
-	Activate(selectTab, orderWindowFront bool) error
-	SplitPane(opts SplitPaneOptions) (Session, error)
+	SendText(ctx context.Context, s string) error
+	Activate(ctx context.Context, selectTab, orderWindowFront bool) error
+	SplitPane(ctx context.Context, opts SplitPaneOptions) (Session, error)
 	GetSessionID() string
-	SetName(string) error
-	GetVariable(string) (string, error)
+	SetName(ctx context.Context, name string) error
+	GetVariable(ctx context.Context, name string) (string, error)
+	// HasShellIntegration reports whether the session's shell has iTerm2's
+	// shell integration installed, which RunCommand depends on.
+	HasShellIntegration(ctx context.Context) (bool, error)
+	// GetBuffer returns the last lines of the session's screen and scrollback.
+	GetBuffer(ctx context.Context, trailingLines int) (Buffer, error)
+	// RunCommand types command into the session and waits for the shell to
+	// report that it finished. It requires shell integration.
+	RunCommand(ctx context.Context, command string) (CommandResult, error)
+	// Close closes the session. With force, iTerm2 does not ask the user to
+	// confirm closing a session that is running a command.
+	Close(ctx context.Context, force bool) error
+	// Restart kills the session's job and starts its command again, in the
+	// same pane. With onlyIfExited, Restart fails if the job is still
+	// running.
+	Restart(ctx context.Context, onlyIfExited bool) error
+}
+
+// CommandResult describes a command that finished running in a session.
+type CommandResult struct {
+	ExitStatus int
+	// End is when iTerm2 reported the command finished.
+	End time.Time
+}
+
+// Buffer is the end of a session's screen and scrollback.
+type Buffer struct {
+	Lines []string
+	// FirstLine is the number of the first of Lines. Lines are numbered from
+	// the first line the session displayed, and keep their numbers when
+	// earlier lines are lost from the scrollback.
+	FirstLine int64
+	// CursorLine is the number of the line the cursor is on.
+	CursorLine int64
+	// Continued tells, for each of Lines, whether it goes on in the next
+	// line, because it was too long for the screen.
+	Continued []bool
 }
 
 // SplitPaneOptions for customizing the new pane session.
@@ -30,8 +70,8 @@ type session struct {
 	id string
 }
 
-func (s *session) SendText(t string) error {
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
+func (s *session) SendText(ctx context.Context, t string) error {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_SendTextRequest{
 			SendTextRequest: &api.SendTextRequest{
 				Session: &s.id,
@@ -48,8 +88,8 @@ func (s *session) SendText(t string) error {
 	return nil
 }
 
-func (s *session) Activate(selectTab, orderWindowFront bool) error {
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
+func (s *session) Activate(ctx context.Context, selectTab, orderWindowFront bool) error {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_ActivateRequest{
 			ActivateRequest: &api.ActivateRequest{
 				Identifier: &api.ActivateRequest_SessionId{
@@ -69,7 +109,7 @@ func (s *session) Activate(selectTab, orderWindowFront bool) error {
 	return nil
 }
 
-func (s *session) SplitPane(opts SplitPaneOptions) (Session, error) {
+func (s *session) SplitPane(ctx context.Context, opts SplitPaneOptions) (Session, error) {
 	direction := api.SplitPaneRequest_HORIZONTAL.Enum()
 	if opts.Vertical {
 		direction = api.SplitPaneRequest_VERTICAL.Enum()
@@ -80,7 +120,7 @@ func (s *session) SplitPane(opts SplitPaneOptions) (Session, error) {
 		return nil, err
 	}
 
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_SplitPaneRequest{
 			SplitPaneRequest: &api.SplitPaneRequest{
 				Session:                 &s.id,
@@ -106,8 +146,8 @@ func (s *session) GetSessionID() string {
 	return s.id
 }
 
-func (s *session) SetName(name string) error {
-	_, err := s.c.Call(&api.ClientOriginatedMessage{
+func (s *session) SetName(ctx context.Context, name string) error {
+	_, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
 			InvokeFunctionRequest: &api.InvokeFunctionRequest{
 				Invocation: str(fmt.Sprintf(`iterm2.set_name(name: "%s")`, name)),
@@ -125,8 +165,8 @@ func (s *session) SetName(name string) error {
 	return nil
 }
 
-func (s *session) GetVariable(name string) (string, error) {
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
+func (s *session) GetVariable(ctx context.Context, name string) (string, error) {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_VariableRequest{
 			VariableRequest: &api.VariableRequest{
 				Scope: &api.VariableRequest_SessionId{
@@ -153,3 +193,147 @@ func (s *session) GetVariable(name string) (string, error) {
 
 	return values[0], nil
 }
+
+func (s *session) HasShellIntegration(ctx context.Context) (bool, error) {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetPromptRequest{
+			GetPromptRequest: &api.GetPromptRequest{
+				Session: &s.id,
+			},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error getting prompt for session %q: %w", s.id, err)
+	}
+	switch status := resp.GetGetPromptResponse().GetStatus(); status {
+	case api.GetPromptResponse_OK:
+		return true, nil
+	case api.GetPromptResponse_PROMPT_UNAVAILABLE:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status for session %q: %s", s.id, status)
+	}
+}
+
+func (s *session) RunCommand(ctx context.Context, command string) (CommandResult, error) {
+	prompts, unsubscribePrompts, err := s.c.Subscribe(ctx, &api.NotificationRequest{
+		Session:          &s.id,
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+	})
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("error subscribing to prompts: %w", err)
+	}
+	defer unsubscribePrompts()
+	terminations, unsubscribeTerminations, err := s.c.Subscribe(ctx, &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_TERMINATE_SESSION.Enum(),
+	})
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("error subscribing to session terminations: %w", err)
+	}
+	defer unsubscribeTerminations()
+
+	if err := s.SendText(ctx, command); err != nil {
+		return CommandResult{}, err
+	}
+
+	// Only take the end of a command that started after we sent ours.
+	started := false
+	for {
+		select {
+		case <-ctx.Done():
+			return CommandResult{}, ctx.Err()
+		case n, ok := <-terminations:
+			if !ok {
+				return CommandResult{}, errors.New("notifications stopped while waiting for command")
+			}
+			if n.GetTerminateSessionNotification().GetSessionId() == s.id {
+				return CommandResult{}, fmt.Errorf("session %q terminated while waiting for command", s.id)
+			}
+		case n, ok := <-prompts:
+			if !ok {
+				return CommandResult{}, errors.New("notifications stopped while waiting for command")
+			}
+			prompt := n.GetPromptNotification()
+			switch {
+			case prompt.GetCommandStart() != nil:
+				started = true
+			case prompt.GetCommandEnd() != nil && started:
+				return CommandResult{
+					ExitStatus: int(prompt.GetCommandEnd().GetStatus()),
+					End:        time.Now(),
+				}, nil
+			}
+		}
+	}
+}
+
+func (s *session) GetBuffer(ctx context.Context, trailingLines int) (Buffer, error) {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetBufferRequest{
+			GetBufferRequest: &api.GetBufferRequest{
+				Session: &s.id,
+				LineRange: &api.LineRange{
+					TrailingLines: proto.Int32(int32(trailingLines)),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return Buffer{}, fmt.Errorf("error getting buffer of session %q: %w", s.id, err)
+	}
+	bufResp := resp.GetGetBufferResponse()
+	if status := bufResp.GetStatus(); status != api.GetBufferResponse_OK {
+		return Buffer{}, fmt.Errorf("unexpected status for session %q: %s", s.id, status)
+	}
+	buf := Buffer{
+		FirstLine:  bufResp.GetWindowedCoordRange().GetCoordRange().GetStart().GetY(),
+		CursorLine: bufResp.GetCursor().GetY(),
+	}
+	for _, line := range bufResp.GetContents() {
+		buf.Lines = append(buf.Lines, line.GetText())
+		buf.Continued = append(buf.Continued, line.GetContinuation() == api.LineContents_CONTINUATION_SOFT_EOL)
+	}
+	return buf, nil
+}
+
+func (s *session) Close(ctx context.Context, force bool) error {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_CloseRequest{
+			CloseRequest: &api.CloseRequest{
+				Target: &api.CloseRequest_Sessions{
+					Sessions: &api.CloseRequest_CloseSessions{
+						SessionIds: []string{s.id},
+					},
+				},
+				Force: &force,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error closing session %q: %w", s.id, err)
+	}
+	for _, status := range resp.GetCloseResponse().GetStatuses() {
+		if status != api.CloseResponse_OK {
+			return fmt.Errorf("unexpected status closing session %q: %s", s.id, status)
+		}
+	}
+	return nil
+}
+
+func (s *session) Restart(ctx context.Context, onlyIfExited bool) error {
+	resp, err := s.c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_RestartSessionRequest{
+			RestartSessionRequest: &api.RestartSessionRequest{
+				SessionId:    &s.id,
+				OnlyIfExited: &onlyIfExited,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error restarting session %q: %w", s.id, err)
+	}
+	if status := resp.GetRestartSessionResponse().GetStatus(); status != api.RestartSessionResponse_OK {
+		return fmt.Errorf("unexpected status restarting session %q: %s", s.id, status)
+	}
+	return nil
+}
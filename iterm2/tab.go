@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pglass/iterm-tool/iterm2/api"
@@ -9,8 +10,15 @@ import (
 
 // Tab abstracts an iTerm2 window tab
 type Tab interface {
-	SetTitle(string) error
-	ListSessions() ([]Session, error)
+	ID() string
+	SetTitle(ctx context.Context, title string) error
+	ListSessions(ctx context.Context) ([]Session, error)
+	// Layout returns the tab's split tree, with the grid size of each session.
+	Layout(ctx context.Context) (*api.SplitTreeNode, error)
+	// SetLayout resizes the tab's sessions. The tree must have the same shape
+	// as the one from Layout. Only the grid sizes of sessions may change, and
+	// they must add up to the same totals.
+	SetLayout(ctx context.Context, root *api.SplitTreeNode) error
 }
 
 type tab struct {
@@ -19,8 +27,12 @@ type tab struct {
 	windowID string
 }
 
-func (t *tab) SetTitle(s string) error {
-	_, err := t.c.Call(&api.ClientOriginatedMessage{
+func (t *tab) ID() string {
+	return t.id
+}
+
+func (t *tab) SetTitle(ctx context.Context, s string) error {
+	_, err := t.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
 			InvokeFunctionRequest: &api.InvokeFunctionRequest{
 				Invocation: str(fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)),
@@ -38,32 +50,83 @@ func (t *tab) SetTitle(s string) error {
 	return nil
 }
 
-func (t *tab) ListSessions() ([]Session, error) {
+func (t *tab) ListSessions(ctx context.Context) ([]Session, error) {
 	list := []Session{}
-	resp, err := t.c.Call(&api.ClientOriginatedMessage{
+	root, err := t.root(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions for tab %q: %w", t.id, err)
+	}
+	for _, id := range splitTreeSessionIDs(root) {
+		list = append(list, &session{
+			c:  t.c,
+			id: id,
+		})
+	}
+	return list, nil
+}
+
+func (t *tab) Layout(ctx context.Context) (*api.SplitTreeNode, error) {
+	root, err := t.root(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting layout of tab %q: %w", t.id, err)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no tab %q in window %q", t.id, t.windowID)
+	}
+	return root, nil
+}
+
+func (t *tab) SetLayout(ctx context.Context, root *api.SplitTreeNode) error {
+	resp, err := t.c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SetTabLayoutRequest{
+			SetTabLayoutRequest: &api.SetTabLayoutRequest{
+				TabId: &t.id,
+				Root:  root,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error setting layout of tab %q: %w", t.id, err)
+	}
+	if status := resp.GetSetTabLayoutResponse().GetStatus(); status != api.SetTabLayoutResponse_OK {
+		return fmt.Errorf("unexpected status setting layout of tab %q: %s", t.id, status)
+	}
+	return nil
+}
+
+// root returns the tab's split tree, or nil if the tab is gone.
+func (t *tab) root(ctx context.Context) (*api.SplitTreeNode, error) {
+	resp, err := t.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
 			ListSessionsRequest: &api.ListSessionsRequest{},
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error listing sessions for tab %q: %w", t.id, err)
+		return nil, err
 	}
-	lsr := resp.GetListSessionsResponse()
-	for _, window := range lsr.GetWindows() {
+	for _, window := range resp.GetListSessionsResponse().GetWindows() {
 		if window.GetWindowId() != t.windowID {
 			continue
 		}
 		for _, wt := range window.GetTabs() {
-			if wt.GetTabId() != t.id {
-				continue
-			}
-			for _, link := range wt.GetRoot().GetLinks() {
-				list = append(list, &session{
-					c:  t.c,
-					id: link.GetSession().GetUniqueIdentifier(),
-				})
+			if wt.GetTabId() == t.id {
+				return wt.GetRoot(), nil
 			}
 		}
 	}
-	return list, nil
+	return nil, nil
+}
+
+// splitTreeSessionIDs returns the ids of the sessions in the tree, in
+// layout order (left to right, top to bottom).
+func splitTreeSessionIDs(node *api.SplitTreeNode) []string {
+	var ids []string
+	for _, link := range node.GetLinks() {
+		if sess := link.GetSession(); sess != nil {
+			ids = append(ids, sess.GetUniqueIdentifier())
+		} else {
+			ids = append(ids, splitTreeSessionIDs(link.GetNode())...)
+		}
+	}
+	return ids
 }
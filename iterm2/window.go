@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -10,12 +11,12 @@ import (
 
 // Window represents an iTerm2 Window
 type Window interface {
-	SetTitle(s string) error
-	CreateTab() (Tab, error)
-	ListTabs() ([]Tab, error)
-	Activate() error
+	SetTitle(ctx context.Context, s string) error
+	CreateTab(ctx context.Context) (Tab, error)
+	ListTabs(ctx context.Context) ([]Tab, error)
+	Activate(ctx context.Context) error
 	ID() string
-	Close(bool) error
+	Close(ctx context.Context, force bool) error
 }
 
 type window struct {
@@ -28,8 +29,8 @@ func (w *window) ID() string {
 	return w.id
 }
 
-func (w *window) CreateTab() (Tab, error) {
-	resp, err := w.c.Call(&api.ClientOriginatedMessage{
+func (w *window) CreateTab(ctx context.Context) (Tab, error) {
+	resp, err := w.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
 			CreateTabRequest: &api.CreateTabRequest{
 				WindowId: str(w.id),
@@ -50,9 +51,9 @@ func (w *window) CreateTab() (Tab, error) {
 	}, nil
 }
 
-func (w *window) ListTabs() ([]Tab, error) {
+func (w *window) ListTabs(ctx context.Context) ([]Tab, error) {
 	list := []Tab{}
-	resp, err := w.c.Call(&api.ClientOriginatedMessage{
+	resp, err := w.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
 			ListSessionsRequest: &api.ListSessionsRequest{},
 		},
@@ -75,8 +76,8 @@ func (w *window) ListTabs() ([]Tab, error) {
 	return list, nil
 }
 
-func (w *window) SetTitle(s string) error {
-	_, err := w.c.Call(&api.ClientOriginatedMessage{
+func (w *window) SetTitle(ctx context.Context, s string) error {
+	_, err := w.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
 			InvokeFunctionRequest: &api.InvokeFunctionRequest{
 				Invocation: str(fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)),
@@ -91,8 +92,8 @@ func (w *window) SetTitle(s string) error {
 	return err
 }
 
-func (w *window) Activate() error {
-	_, err := w.c.Call(&api.ClientOriginatedMessage{
+func (w *window) Activate(ctx context.Context) error {
+	_, err := w.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_ActivateRequest{ActivateRequest: &api.ActivateRequest{
 			Identifier:       &api.ActivateRequest_WindowId{WindowId: w.id},
 			OrderWindowFront: b(true),
@@ -101,8 +102,8 @@ func (w *window) Activate() error {
 	return err
 }
 
-func (w *window) Close(force bool) error {
-	_, err := w.c.Call(&api.ClientOriginatedMessage{
+func (w *window) Close(ctx context.Context, force bool) error {
+	_, err := w.c.CallContext(ctx, &api.ClientOriginatedMessage{
 		Submessage: &api.ClientOriginatedMessage_CloseRequest{
 			CloseRequest: &api.CloseRequest{
 				Target: &api.CloseRequest_Windows{
@@ -0,0 +1,194 @@
+// Package layout describes how sessions are arranged in a window, as nested
+// rows and columns of panes, and plans the pane splits that create it.
+package layout
+
+import "math"
+
+// Node is a pane holding a session, or a part of the window divided into
+// Children.
+type Node struct {
+	// Session is the session in the pane. Only leaves have one.
+	Session string `json:"session,omitempty"`
+	// Size is the node's share of its parent, relative to its siblings.
+	// Defaults to 1.
+	Size float64 `json:"size,omitempty"`
+	// Columns lays Children out side by side, rather than top to bottom.
+	Columns  bool    `json:"columns,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Leaf returns a node holding a session.
+func Leaf(session string) *Node {
+	return &Node{Session: session}
+}
+
+// Weight returns Size, or its default if it is unset.
+func (n *Node) Weight() float64 {
+	if n.Size <= 0 {
+		return 1
+	}
+	return n.Size
+}
+
+// Sessions returns the sessions under n in layout order: left to right, top
+// to bottom.
+func (n *Node) Sessions() []string {
+	if len(n.Children) == 0 {
+		return []string{n.Session}
+	}
+	var result []string
+	for _, child := range n.Children {
+		result = append(result, child.Sessions()...)
+	}
+	return result
+}
+
+// Walk calls f for n and every node under it, parents first.
+func (n *Node) Walk(f func(*Node)) {
+	f(n)
+	for _, child := range n.Children {
+		child.Walk(f)
+	}
+}
+
+// Flatten returns a copy of n shaped the way terminals keep their panes:
+// rows directly inside rows (or columns inside columns) are merged into their
+// parent, and a node with one child is replaced by it. Sizes are scaled so
+// each pane keeps its share of the window.
+func (n *Node) Flatten() *Node {
+	if len(n.Children) == 0 {
+		return &Node{Session: n.Session, Size: n.Size}
+	}
+	flat := &Node{Size: n.Size, Columns: n.Columns}
+	for _, child := range n.Children {
+		child = child.Flatten()
+		if len(child.Children) == 0 || child.Columns != n.Columns {
+			flat.Children = append(flat.Children, child)
+			continue
+		}
+		sum := 0.0
+		for _, grandchild := range child.Children {
+			sum += grandchild.Weight()
+		}
+		for _, grandchild := range child.Children {
+			grandchild.Size = child.Weight() * grandchild.Weight() / sum
+			flat.Children = append(flat.Children, grandchild)
+		}
+	}
+	if len(flat.Children) == 1 {
+		only := flat.Children[0]
+		only.Size = n.Size
+		return only
+	}
+	return flat
+}
+
+// Default returns the layout the tool uses when the config has none: a
+// column per group, with the sessions of a group stacked in rows.
+func Default(groups [][]string) *Node {
+	root := &Node{Columns: true}
+	for _, sessions := range groups {
+		column := &Node{}
+		for _, session := range sessions {
+			column.Children = append(column.Children, Leaf(session))
+		}
+		if len(column.Children) == 1 {
+			column = column.Children[0]
+		}
+		root.Children = append(root.Children, column)
+	}
+	if len(root.Children) == 1 {
+		return root.Children[0]
+	}
+	return root
+}
+
+// Split is a pane split that creates part of a layout.
+type Split struct {
+	// From is the session whose pane is split.
+	From string
+	// To is the session that gets the new pane.
+	To string
+	// Vertical puts the new pane to the right of From, rather than below it.
+	Vertical bool
+}
+
+// Splits returns the splits that create root from a single pane, which holds
+// its first session. Each split is from a pane created earlier.
+//
+// Splits divide the window from the outside in: all the columns of the top
+// level first, then the rows within each column, and so on.
+func Splits(root *Node) []Split {
+	var splits []Split
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		// The pane holding n's first session is split into one pane per
+		// child. Splitting the newest pane each time keeps them in order.
+		for i := 1; i < len(n.Children); i++ {
+			splits = append(splits, Split{
+				From:     n.Children[i-1].Sessions()[0],
+				To:       n.Children[i].Sessions()[0],
+				Vertical: n.Columns,
+			})
+		}
+		for _, child := range n.Children {
+			visit(child)
+		}
+	}
+	visit(root)
+	return splits
+}
+
+// Distribute divides total cells among nodes in proportion to their weights.
+// Every node gets at least one cell, if there are enough, and the result
+// always adds up to total.
+func Distribute(total int, weights []float64) []int {
+	result := make([]int, len(weights))
+	if len(weights) == 0 {
+		return result
+	}
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+
+	// Largest remainder: round down, then hand out the cells left over to
+	// the nodes that lost the most.
+	remainders := make([]float64, len(weights))
+	given := 0
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		result[i] = int(math.Floor(exact))
+		remainders[i] = exact - float64(result[i])
+		given += result[i]
+	}
+	for ; given < total; given++ {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		result[best]++
+		remainders[best] = -1
+	}
+
+	// Take cells from the largest nodes for those that got none.
+	for i := range result {
+		if result[i] > 0 {
+			continue
+		}
+		largest := 0
+		for j := range result {
+			if result[j] > result[largest] {
+				largest = j
+			}
+		}
+		if result[largest] <= 1 {
+			break
+		}
+		result[largest]--
+		result[i]++
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault(t *testing.T) {
+	root := Default([][]string{{"setup"}, {"worker.1", "worker.2"}})
+	require.Equal(t, &Node{Columns: true, Children: []*Node{
+		Leaf("setup"),
+		{Children: []*Node{Leaf("worker.1"), Leaf("worker.2")}},
+	}}, root)
+
+	require.Equal(t, Leaf("setup"), Default([][]string{{"setup"}}))
+	require.Equal(t, &Node{Children: []*Node{Leaf("a.1"), Leaf("a.2")}}, Default([][]string{{"a.1", "a.2"}}))
+}
+
+func TestFlatten(t *testing.T) {
+	root := &Node{Columns: true, Children: []*Node{
+		{Size: 2, Session: "editor"},
+		{Columns: true, Children: []*Node{
+			{Size: 3, Session: "server"},
+			{Session: "logs"},
+		}},
+		{Children: []*Node{{Size: 4, Session: "shell"}}},
+	}}
+	require.Equal(t, &Node{Columns: true, Children: []*Node{
+		{Size: 2, Session: "editor"},
+		{Size: 0.75, Session: "server"},
+		{Size: 0.25, Session: "logs"},
+		Leaf("shell"),
+	}}, root.Flatten())
+
+	// The original is unchanged.
+	require.Equal(t, 3.0, root.Children[1].Children[0].Size)
+}
+
+func TestSplits(t *testing.T) {
+	tests := []struct {
+		name string
+		root *Node
+		exp  []Split
+	}{
+		{
+			name: "single",
+			root: Leaf("setup"),
+		},
+		{
+			// Columns first, then rows, like the tool always did.
+			name: "default",
+			root: Default([][]string{{"a.1", "a.2", "a.3"}, {"b"}, {"c.1", "c.2"}}),
+			exp: []Split{
+				{From: "a.1", To: "b", Vertical: true},
+				{From: "b", To: "c.1", Vertical: true},
+				{From: "a.1", To: "a.2"},
+				{From: "a.2", To: "a.3"},
+				{From: "c.1", To: "c.2"},
+			},
+		},
+		{
+			name: "nested",
+			root: &Node{Children: []*Node{
+				{Columns: true, Children: []*Node{
+					Leaf("editor"),
+					{Children: []*Node{Leaf("server"), Leaf("logs")}},
+				}},
+				Leaf("shell"),
+			}},
+			exp: []Split{
+				{From: "editor", To: "shell"},
+				{From: "editor", To: "server", Vertical: true},
+				{From: "server", To: "logs"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.exp, Splits(tt.root))
+		})
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		weights []float64
+		exp     []int
+	}{
+		{name: "equal", total: 9, weights: []float64{1, 1, 1}, exp: []int{3, 3, 3}},
+		{name: "remainder", total: 10, weights: []float64{1, 1, 1}, exp: []int{4, 3, 3}},
+		{name: "weighted", total: 80, weights: []float64{1, 3}, exp: []int{20, 60}},
+		{name: "largest-remainder", total: 10, weights: []float64{1, 2, 2}, exp: []int{2, 4, 4}},
+		{name: "at-least-one", total: 10, weights: []float64{100, 1}, exp: []int{9, 1}},
+		{name: "too-small", total: 1, weights: []float64{1, 1}, exp: []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Distribute(tt.total, tt.weights)
+			require.Equal(t, tt.exp, got)
+		})
+	}
+}
@@ -1,231 +1,310 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
-	"sort"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/pglass/iterm-tool/backend"
 	"github.com/pglass/iterm-tool/config"
-	"github.com/pglass/iterm-tool/iterm2"
+	"github.com/pglass/iterm-tool/layout"
+	"github.com/pglass/iterm-tool/plan"
+	"github.com/pglass/iterm-tool/probe"
+	"github.com/pglass/iterm-tool/scheduler"
+	"github.com/urfave/cli/v2"
 )
 
-var (
-	flagConfigFile string
-
-	sessionProps = iterm2.CustomProfileProperties{
-		TitleComponents: iterm2.TitleComponentSessionName,
-	}
+const (
+	// setupTimeout bounds creating the window and panes.
+	setupTimeout = 2 * time.Minute
+	// rpcTimeout bounds each call to the terminal after setup.
+	// Together, they keep a hung terminal from wedging the tool.
+	rpcTimeout = 30 * time.Second
 )
 
-func init() {
-	flag.StringVar(&flagConfigFile, "c", "", "config file")
-}
-
 func main() {
-	flag.Parse()
-
-	if len(flagConfigFile) == 0 {
-		log.Fatalf("config file is required")
+	if err := newApp().Run(os.Args); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	slog.SetLogLoggerLevel(slog.LevelDebug)
-	slog.Info("load config", "file", flagConfigFile)
-
-	cfg, err := config.LoadConfig(flagConfigFile)
-	die("load config", err)
+func newApp() *cli.App {
+	return &cli.App{
+		Name:  "iterm-tool",
+		Usage: "run the sessions of a config in iTerm2, tmux or headless shells",
+		// A file name with a comma is still one file.
+		DisableSliceFlagSeparator: true,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "config `file` (repeat to overlay files, later files take precedence)",
+			},
+			&cli.StringFlag{
+				Name:  "backend",
+				Usage: fmt.Sprintf("terminal backend, one of %v (overrides the backend set in the config file)", backend.Names),
+			},
+			&cli.StringFlag{
+				Name:  "log-dir",
+				Usage: "directory for session logs (pty backend only)",
+			},
+			&cli.IntFlag{
+				Name:  "max-parallel",
+				Usage: "maximum number of sessions running their script or inject at once (0 means no limit)",
+			},
+			dryRunFlag,
+		},
+		// Without a command, start over, as the tool always did.
+		Action: func(c *cli.Context) error {
+			if c.Args().Present() {
+				return cli.Exit(fmt.Sprintf("unknown command %q", c.Args().First()), 1)
+			}
+			return upCommand(c, true)
+		},
+		Commands: commands,
+	}
+}
 
-	cache, err := NewCache()
-	die("init cache", err)
+// logEvent logs the progress of sessions.
+func logEvent(e scheduler.Event) {
+	switch e.Type {
+	case scheduler.Failed:
+		slog.Error("session failed", "name", e.Task, "error", e.Err)
+	case scheduler.Skipped:
+		slog.Warn("session skipped", "name", e.Task, "reason", e.Err)
+	default:
+		slog.Info("session "+e.Type.String(), "name", e.Task)
+	}
+}
 
-	slog.Info("creating stack", "id", cfg.ID)
-	app, err := iterm2.NewApp(cfg.ID)
+// arrange splits a new tab into the panes of root, and returns the pane of
+// each session. The tab starts with one pane, which holds root's first
+// session. With resize, the panes are sized to root too, if the terminal
+// can.
+func arrange(ctx context.Context, tab backend.Tab, root *layout.Node, resize bool) (map[string]backend.Pane, error) {
+	panes, err := tab.ListPanes(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	if len(panes) == 0 {
+		return nil, errors.New("no sessions in tab")
 	}
-	defer app.Close()
-
-	windows, err := app.ListWindows()
-	die("list windows", err)
-
-	cached, err := cache.Get(cfg.ID)
-	die("read cache", err)
 
-	// Find the existing window or create new window.
-	for _, w := range windows {
-		if w.ID() == cached.WindowID {
-			slog.Info("closing existing window", "id", w.ID())
-			die("closing existing window", w.Close(true))
-			break
+	assignment := map[string]backend.Pane{root.Sessions()[0]: panes[0]}
+	slog.Info("assigned initial session", "name", root.Sessions()[0])
+	for _, split := range layout.Splits(root) {
+		pane, err := assignment[split.From].Split(ctx, split.Vertical)
+		if err != nil {
+			return nil, fmt.Errorf("split pane: %w", err)
 		}
+		assignment[split.To] = pane
+		slog.Info("assigned new session", "name", split.To, "from", split.From, "vertical", split.Vertical)
 	}
+	if resizer, ok := tab.(backend.Resizer); ok && resize {
+		if err := resizer.Resize(ctx, root, assignment); err != nil {
+			return nil, fmt.Errorf("resize panes: %w", err)
+		}
+	}
+	return assignment, nil
+}
 
-	window, err := app.CreateWindow(&iterm2.CreateWindowOpts{
-		CustomProfileProperties: sessionProps,
-	})
-	die("create window", err)
-
-	cached.WindowID = window.ID()
-	die("write cache", cache.Put(cfg.ID, cached))
-
-	slog.Info("created window", "id", window.ID())
+// runSession runs the session's script, retrying according to its failure
+// policy, then its inject lines, and then waits for it to be ready. Inject
+// lines are not sent if the script failed.
+func runSession(ctx context.Context, sess backend.Pane, scfg *config.Session) error {
+	watch, err := newOutputWatch(ctx, sess, scfg)
+	if err != nil {
+		return err
+	}
+	if scfg.Script != "" {
+		var err error
+		for attempt := 1; attempt <= scfg.Attempts(); attempt++ {
+			if attempt > 1 {
+				slog.Warn("retrying script", "name", scfg.Name, "attempt", attempt, "error", err)
+			}
+			err = feedScriptAndWaitForDone(ctx, sess, scfg, watch)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("running script: %w", err)
+		}
+	}
+	if scfg.Inject != "" {
+		if err := feedInject(ctx, sess, scfg, watch); err != nil {
+			return fmt.Errorf("running inject: %w", err)
+		}
+	}
+	if scfg.Ready != nil {
+		if err := waitForReady(ctx, scfg, watch); err != nil {
+			return fmt.Errorf("waiting for ready: %w", err)
+		}
+	}
+	return nil
+}
 
-	err = window.SetTitle(cfg.ID)
-	die("set window title", err)
+// outputWatch reads the output of the text last sent to a session, for
+// ready.match.
+type outputWatch struct {
+	reader backend.ScreenReader
+	// offset is where the session's output went when the text was sent.
+	offset int64
+	// echo is the last line of the text. The shell echoes the text before
+	// running it, so its output starts on the line after the echo.
+	echo string
+}
 
-	tabs, err := window.ListTabs()
-	die("list tabs", err)
-	if len(tabs) == 0 {
-		log.Fatal("no tabs in window")
+// newOutputWatch returns a watch on the session's output, or nil if its
+// readiness does not depend on its output.
+func newOutputWatch(ctx context.Context, session backend.Pane, scfg *config.Session) (*outputWatch, error) {
+	if scfg.Ready == nil || scfg.Ready.Match == "" {
+		return nil, nil
 	}
-
-	tab := tabs[0]
-	sessions, err := tab.ListSessions()
-	die("list sessions", err)
-	if len(sessions) == 0 {
-		log.Fatalf("no sessions in tab")
+	reader, ok := session.(backend.ScreenReader)
+	if !ok {
+		return nil, errors.New("ready.match is not supported by this backend")
 	}
+	w := &outputWatch{reader: reader}
+	return w, w.sending(ctx, "")
+}
 
-	assignment := map[string]iterm2.Session{}
-	lastInGroup := map[string]iterm2.Session{}
-
-	addSplit := func(sessCfg *config.Session, splitFrom iterm2.Session, vertical bool) {
-		group := sessCfg.Group()
-		if len(assignment) == 0 {
-			// Tabs are created with a split. Assign it on the first call.
-			assignment[sessCfg.Name] = sessions[0]
-			lastInGroup[group] = sessions[0]
-			slog.Info("assigned initial session", "name", sessCfg.Name, "group", group)
-			return
-		}
+// sending marks the session's output as starting with text, which is about
+// to be sent.
+func (w *outputWatch) sending(ctx context.Context, text string) error {
+	if w == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	offset, err := w.reader.ScreenOffset(ctx)
+	if err != nil {
+		return fmt.Errorf("read screen offset: %w", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	w.offset, w.echo = offset, strings.TrimSpace(lines[len(lines)-1])
+	return nil
+}
 
-		sess, err := splitFrom.SplitPane(iterm2.SplitPaneOptions{
-			Vertical:                vertical,
-			CustomProfileProperties: sessionProps,
-		})
-		die("split pane", err)
-
-		assignment[sessCfg.Name] = sess
-		lastInGroup[group] = sess
-		sessions = append(sessions, sess)
-		slog.Info("assigned new session", "name", sessCfg.Name, "group", group)
-	}
-
-	// Use a simple rule for splits:
-	// - Do all vertical splits before horizontal splits.
-	// - Do one vsplit per group (so, one column per group)
-	// - Do one hsplit for additional group members.
-	sessionConfigsByGroup := cfg.SessionsByGroup()
-	for _, group := range SortedKeys(sessionConfigsByGroup) {
-		// Create one vertical split per group
-		// We'll assign the first session in each group to a vpslit.
-		sessCfg := sessionConfigsByGroup[group][0]
-		splitFrom := sessions[len(sessions)-1]
-		addSplit(sessCfg, splitFrom, true /* vertical */)
-	}
-	for group, cfgs := range cfg.SessionsByGroup() {
-		// We already assigned the first cfg in each group.
-		for _, sessCfg := range cfgs[1:] {
-			splitFrom := lastInGroup[group]
-			addSplit(sessCfg, splitFrom, false /* not vertical */)
-		}
+// output returns what the session printed since the text was sent, leaving
+// out its echo, so that ready.match cannot match the text itself. It is
+// empty until the shell echoed the text.
+func (w *outputWatch) output(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	screen, err := w.reader.ReadScreen(ctx, w.offset)
+	if err != nil {
+		return "", err
+	}
+	if w.echo == "" {
+		return screen, nil
 	}
+	// Text typed before the shell reads it is echoed twice: once by the
+	// terminal, and once more by the shell.
+	i := strings.LastIndex(screen, w.echo)
+	if i < 0 {
+		return "", nil
+	}
+	_, output, _ := strings.Cut(screen[i+len(w.echo):], "\n")
+	return output, nil
+}
 
-	// Prep sessions.
-	// - Navigate to a specified directory.
-	for name := range cfg.Sessions {
-		sess, ok := assignment[name]
-		if !ok {
-			log.Fatalf("[bug] no assigned session: name=%s", name)
+// printFailureSummary lists the sessions that did not succeed, if any, and
+// reports whether all sessions succeeded.
+func printFailureSummary(w io.Writer, results []scheduler.Result) bool {
+	ok := true
+	for _, r := range results {
+		if r.Status == scheduler.StatusSucceeded {
+			continue
 		}
-		die("set session name", sess.SetName(name))
-		if cfg.Directory != "" {
-			die("send text", sess.SendText(fmt.Sprintf("cd %s\n", cfg.Directory)))
+		if ok {
+			fmt.Fprintln(w, "Some sessions did not complete:")
+			ok = false
 		}
+		fmt.Fprintf(w, "  %s: %s: %s\n", r.Name, r.Status, r.Err)
 	}
+	return ok
+}
 
-	// We need to traverse a dependency tree of session config.
-	// I'm lazy, so the way this will work is:
-	//
-	//  0. Run commands for sessions with no dependencies
-	//  1. Find the next group of sessions that can run.
-	//     - Iterate all sessions. If the session is not done, and all
-	//       items in a session's depends_on are done, then we'll
-	//       process this session config next.
-	//  2. If not all done, repeat from 1
-	//
-	// We just need to maintain a map of "done" sessions.
-	doneSessions := map[string]struct{}{}
-	for len(doneSessions) < len(cfg.Sessions) {
-
-		var wg sync.WaitGroup
-
-		for _, scfg := range getNextSessionsInTree(doneSessions, cfg) {
-			scfg := scfg
-
-			sess, ok := assignment[scfg.Name]
-			if !ok {
-				log.Fatalf("[bug] no assigned session: name=%s", scfg.Name)
-			}
-
-			// TODO: context
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				if scfg.Script != "" {
-					if err := feedScriptAndWaitForDone(sess, scfg); err != nil {
-						slog.Error("running script", "error", err)
-					}
-				}
-				if scfg.Inject != "" {
-					if err := feedInject(sess, scfg); err != nil {
-						slog.Error("running inject", "error", err)
-					}
-				}
-				doneSessions[scfg.Name] = struct{}{}
-			}()
-		}
+// exitError is returned when a script exits with a non-zero status.
+type exitError struct {
+	status int
+}
 
-		// Wait for this group to finish.
-		// TODO: Some scripts never end. We need some way to start those, but not wait for them.
-		wg.Wait()
-	}
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.status)
 }
 
-func feedScriptAndWaitForDone(session iterm2.Session, scfg *config.Session) error {
-	doneFile, err := os.CreateTemp("", fmt.Sprintf("%s-done-*", scfg.Name))
-	die("create temp file", err)
+func feedScriptAndWaitForDone(ctx context.Context, session backend.Pane, scfg *config.Session, watch *outputWatch) error {
+	doneFile, err := os.CreateTemp("", plan.DoneFilePattern(scfg.Name))
+	if err != nil {
+		return fmt.Errorf("create done file: %w", err)
+	}
 	defer os.Remove(doneFile.Name())
 	doneFile.Close()
 
-	scriptFile, err := os.CreateTemp("", fmt.Sprintf("%s-script-*", scfg.Name))
-	die("create temp file", err)
+	scriptFile, err := os.CreateTemp("", plan.ScriptFilePattern(scfg.Name))
+	if err != nil {
+		return fmt.Errorf("create script file: %w", err)
+	}
 	defer os.Remove(scriptFile.Name())
 
 	slog.Info("preparing session files", "done", doneFile.Name(), "script", scriptFile.Name())
 
-	// Run the configured script.
-	scriptFile.WriteString("set -x\n")
-	scriptFile.WriteString(scfg.Script)
-
-	// After the configured script is done.
-	scriptFile.WriteString(fmt.Sprintf("\necho 'done' > %s\n", doneFile.Name()))
-	scriptFile.Close()
+	_, err = scriptFile.WriteString(plan.WrapScript(scfg.Script, doneFile.Name()))
+	if err := errors.Join(err, scriptFile.Close()); err != nil {
+		return fmt.Errorf("write script file: %w", err)
+	}
 
 	time.Sleep(1 * time.Second)
 
-	die("send text", session.SendText(
-		fmt.Sprintf("bash %s\n", scriptFile.Name())),
-	)
+	command := plan.RunScript(scriptFile.Name())
+	if err := watch.sending(ctx, command); err != nil {
+		return err
+	}
+
+	// Prefer waiting for the shell to report the command finished. This needs
+	// shell integration, so fall back to polling the done file without it.
+	if runner, ok := session.(backend.CommandRunner); ok {
+		checkCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+		can, err := runner.CanRunCommands(checkCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("check for shell integration: %w", err)
+		}
+		if can {
+			slog.Info("started sesssion", "name", scfg.Name, "wait", "prompt")
+			result, err := runner.RunCommand(ctx, command)
+			if err != nil {
+				return err
+			}
+			slog.Info("script finished", "name", scfg.Name, "exit_status", result.ExitStatus, "end", result.End)
+			if result.ExitStatus != 0 {
+				return &exitError{status: result.ExitStatus}
+			}
+			return nil
+		}
+		slog.Info("no shell integration, polling for done file", "name", scfg.Name)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	if err := session.SendText(sendCtx, command); err != nil {
+		return fmt.Errorf("send script: %w", err)
+	}
 
-	slog.Info("started sesssion", "name", scfg.Name)
+	slog.Info("started sesssion", "name", scfg.Name, "wait", "file")
 
-	// Wait for the pid file to be written
+	// Wait for the done file to be written
 	for {
 		data, err := os.ReadFile(doneFile.Name())
 		if err != nil {
@@ -233,71 +312,86 @@ func feedScriptAndWaitForDone(session iterm2.Session, scfg *config.Session) erro
 		}
 		content := strings.TrimSpace(string(data))
 		if len(content) != 0 {
-			break
+			status, err := strconv.Atoi(content)
+			if err != nil {
+				return fmt.Errorf("unexpected content in done file: %q", content)
+			}
+			slog.Info("script finished", "name", scfg.Name, "exit_status", status, "end", time.Now())
+			if status != 0 {
+				return &exitError{status: status}
+			}
+			return nil
 		}
 
-		time.Sleep(2 * time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
 
 		// Check if the session has closed.
-		if _, err := session.GetVariable("jobName"); err != nil {
-			return fmt.Errorf("session closed while waiting for script (unable to get variable jobName from session, which is the hack I'm using to check if closed: %w)", err)
+		aliveCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+		err = session.Alive(aliveCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("session closed while waiting for script: %w", err)
 		}
 	}
-	return nil
 }
 
-func feedInject(session iterm2.Session, scfg *config.Session) error {
+func feedInject(ctx context.Context, session backend.Pane, scfg *config.Session, watch *outputWatch) error {
 	slog.Info("feeding inject lines", "session", scfg.Name)
 
-	die("send text", session.SendText(scfg.Inject+"\n"))
+	inject := plan.Inject(scfg)
+	if err := watch.sending(ctx, inject); err != nil {
+		return err
+	}
 
-	// TODO: How to check we're done? I don't want to modify the inject lines
-	// because I want to up arrow easily.
+	sendCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	if err := session.SendText(sendCtx, inject); err != nil {
+		return fmt.Errorf("send inject: %w", err)
+	}
+
+	// There is no telling when inject lines are done without modifying them,
+	// and I want to up arrow easily. A `ready` block says when they are far
+	// enough along instead; see waitForReady.
 
 	return nil
 }
 
-func getNextSessionsInTree(doneSessions map[string]struct{}, cfg *config.Config) []*config.Session {
-	isDone := func(name string) bool {
-		_, done := doneSessions[name]
-		return done
+// waitForReady waits for the session's readiness checks to pass.
+func waitForReady(ctx context.Context, scfg *config.Session, watch *outputWatch) error {
+	r := scfg.Ready
+	var probes []probe.Probe
+	if r.TCP != "" {
+		probes = append(probes, probe.TCP{Address: r.TCP})
 	}
-
-	var result []*config.Session
-	for _, scfg := range cfg.Sessions {
-		if isDone(scfg.Name) {
-			continue
-		}
-
-		dependsOnDone := true
-		for _, name := range scfg.DependsOn {
-			if strings.HasPrefix(name, "sessions.") {
-				name = strings.SplitN(name, ".", 2)[1]
-			}
-			if !isDone(name) {
-				dependsOnDone = false
-			}
-		}
-
-		if dependsOnDone {
-			result = append(result, scfg)
+	if r.HTTP != "" {
+		probes = append(probes, probe.HTTP{URL: r.HTTP, Status: r.Status})
+	}
+	if r.File != "" {
+		path := r.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(scfg.WorkDir(), path)
 		}
+		probes = append(probes, probe.File{Path: path})
 	}
-
-	return result
-}
-
-func die(msg string, err error) {
-	if err != nil {
-		log.Fatalf("%s error: %s", msg, err)
+	if r.Match != "" {
+		probes = append(probes, probe.Match{
+			// Validated when loading the config.
+			Pattern: regexp.MustCompile(r.Match),
+			Screen:  watch.output,
+		})
+	}
+	if r.Command != "" {
+		probes = append(probes, probe.Command{Command: r.Command, Dir: scfg.WorkDir(), Env: scfg.Environment()})
 	}
-}
 
-func SortedKeys[V any](m map[string]V) []string {
-	result := []string{}
-	for k := range m {
-		result = append(result, k)
+	slog.Info("waiting for session to be ready", "session", scfg.Name, "checks", probes)
+	if err := probe.Wait(ctx, probes, r.CheckInterval(), r.WaitTimeout()); err != nil {
+		return err
 	}
-	sort.Strings(result)
-	return result
+	slog.Info("session is ready", "session", scfg.Name)
+	return nil
 }
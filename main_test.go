@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pglass/iterm-tool/backend"
+	"github.com/pglass/iterm-tool/config"
+	"github.com/stretchr/testify/require"
+)
+
+// newTmuxBackend returns a tmux backend, on a server of its own.
+func newTmuxBackend(t *testing.T) backend.Backend {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Setenv("SHELL", "bash")
+	term, err := backend.New(backend.Tmux, backend.Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+	return term
+}
+
+func TestRunSessionReadyMatch(t *testing.T) {
+	backends := map[string]func(t *testing.T) backend.Backend{
+		backend.Pty: func(t *testing.T) backend.Backend {
+			term, _ := newTestBackend(t)
+			return term
+		},
+		backend.Tmux: newTmuxBackend,
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		inject string
+		match  string
+
+		expReady bool
+	}{
+		{
+			name:     "output",
+			inject:   "echo $((6 * 7))",
+			match:    "42",
+			expReady: true,
+		},
+		{
+			name:   "only in the inject",
+			inject: "true wumbo",
+			match:  "wumbo",
+		},
+		{
+			name:   "only in a long inject",
+			inject: "true " + strings.Repeat("x", 300) + " wumbo",
+			match:  "wumbo",
+		},
+		{
+			name:     "in the inject and the output",
+			inject:   "echo wumbo",
+			match:    "wumbo",
+			expReady: true,
+		},
+		{
+			name:     "output of the script",
+			script:   "echo $((6 * 7))",
+			match:    "42",
+			expReady: true,
+		},
+		{
+			name:   "output of the script before the inject",
+			script: "echo $((6 * 7))",
+			inject: "true",
+			match:  "42",
+		},
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					term := newBackend(t)
+					ctx := context.Background()
+					window, err := term.CreateWindow(ctx, "test")
+					require.NoError(t, err)
+					t.Cleanup(func() { term.CloseWindow(ctx, window.ID()) })
+					tabs, err := window.ListTabs(ctx)
+					require.NoError(t, err)
+					panes, err := tabs[0].ListPanes(ctx)
+					require.NoError(t, err)
+
+					scfg := &config.Session{
+						Name:   "a",
+						Script: tt.script,
+						Inject: tt.inject,
+						Ready: &config.Ready{
+							Match:    tt.match,
+							Interval: 50 * time.Millisecond,
+							Timeout:  3 * time.Second,
+						},
+					}
+					err = runSession(ctx, panes[0], scfg)
+					if tt.expReady {
+						require.NoError(t, err)
+					} else {
+						require.ErrorContains(t, err, "not ready")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRunSessionSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		scfg config.Session
+
+		expErr string
+	}{
+		{
+			name:   "inject",
+			scfg:   config.Session{Name: "a", Inject: "true"},
+			expErr: "running inject: send inject: shell in pane",
+		},
+		{
+			name:   "script",
+			scfg:   config.Session{Name: "a", Script: "true", OnFailure: config.OnFailureRetry, Retries: 1},
+			expErr: "running script: send script: shell in pane",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term, _ := newTestBackend(t)
+			ctx := context.Background()
+			window, err := term.CreateWindow(ctx, "test")
+			require.NoError(t, err)
+			tabs, err := window.ListTabs(ctx)
+			require.NoError(t, err)
+			panes, err := tabs[0].ListPanes(ctx)
+			require.NoError(t, err)
+			pane := panes[0]
+			require.NoError(t, pane.SendText(ctx, "exit\n"))
+			require.Eventually(t, func() bool { return pane.Alive(ctx) != nil }, 5*time.Second, 50*time.Millisecond)
+
+			// The error is returned, for the session's failure policy,
+			// rather than ending the process.
+			err = runSession(ctx, pane, &tt.scfg)
+			require.ErrorContains(t, err, tt.expErr)
+		})
+	}
+}
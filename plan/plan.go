@@ -0,0 +1,190 @@
+// Package plan works out what running a config does, without touching a
+// terminal: how each tab is split into panes, which session runs in each
+// pane, the order the sessions start in, and the text sent to each session.
+package plan
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pglass/iterm-tool/config"
+	"github.com/pglass/iterm-tool/layout"
+	"github.com/pglass/iterm-tool/shell"
+)
+
+// Plan is what running a config from scratch does.
+type Plan struct {
+	// Tabs are the tabs of the config, in the order they are opened.
+	Tabs []Tab `json:"tabs"`
+	// Waves group the sessions by when they can start. Each session
+	// depends only on sessions in earlier waves.
+	Waves [][]string `json:"waves"`
+	// Sessions are the sessions of the config, sorted by name.
+	Sessions []Session `json:"sessions"`
+}
+
+// Tab is a tab, and the panes it is split into.
+type Tab struct {
+	// Window is the title of the tab's window.
+	Window string `json:"window"`
+	// Title is the tab's title, if it sets one.
+	Title  string       `json:"title,omitempty"`
+	Layout *layout.Node `json:"layout"`
+	// Panes are the panes of the tab, in the order they are created. The
+	// first comes with the tab.
+	Panes []Pane `json:"panes"`
+}
+
+// Pane is a pane of a tab, and the session it runs.
+type Pane struct {
+	Session string `json:"session"`
+	// SplitFrom is the session whose pane is split to create this one. It
+	// is empty for the first pane of a tab.
+	SplitFrom string `json:"split_from,omitempty"`
+	// Vertical puts the pane to the right of SplitFrom's pane, rather than
+	// below it.
+	Vertical bool `json:"vertical,omitempty"`
+}
+
+// Session is the text sent to a session, in the order it is sent.
+type Session struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Setup changes to the session's directory and exports its
+	// environment.
+	Setup string `json:"setup,omitempty"`
+	// Script is the wrapper that runs the session's script, ScriptFile the
+	// temporary file it is written to, and RunScript the text that runs it.
+	// They are empty if the session has no script.
+	Script     string `json:"script,omitempty"`
+	ScriptFile string `json:"script_file,omitempty"`
+	RunScript  string `json:"run_script,omitempty"`
+	// Attempts is how many times the script runs, at most.
+	Attempts int    `json:"attempts,omitempty"`
+	Inject   string `json:"inject,omitempty"`
+}
+
+// tempDir stands for the directory of temporary files in a plan. The * in
+// their names stands for the random part picked at run time.
+const tempDir = "$TMPDIR"
+
+// New returns the plan of cfg.
+func New(cfg *config.Config) *Plan {
+	p := &Plan{Waves: Waves(cfg)}
+	for _, place := range cfg.Places() {
+		root := cfg.LayoutTree(place)
+		tab := Tab{
+			Window: cfg.WindowTitle(place.Window),
+			Title:  cfg.TabTitle(place),
+			Layout: root,
+			Panes:  []Pane{{Session: root.Sessions()[0]}},
+		}
+		for _, split := range layout.Splits(root) {
+			tab.Panes = append(tab.Panes, Pane{Session: split.To, SplitFrom: split.From, Vertical: split.Vertical})
+		}
+		p.Tabs = append(p.Tabs, tab)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Sessions)) {
+		sess := cfg.Sessions[name]
+		planned := Session{
+			Name:      name,
+			DependsOn: sess.Dependencies(),
+			Setup:     Setup(sess),
+			Inject:    Inject(sess),
+		}
+		if sess.Script != "" {
+			planned.Script = WrapScript(sess.Script, path.Join(tempDir, DoneFilePattern(name)))
+			planned.ScriptFile = path.Join(tempDir, ScriptFilePattern(name))
+			planned.RunScript = RunScript(planned.ScriptFile)
+			planned.Attempts = sess.Attempts()
+		}
+		p.Sessions = append(p.Sessions, planned)
+	}
+	return p
+}
+
+// Waves groups the sessions of cfg by how long a chain of dependencies
+// leads up to them: sessions without dependencies come first, then the
+// sessions that depend only on those, and so on. Each wave is sorted.
+func Waves(cfg *config.Config) [][]string {
+	depth := map[string]int{}
+	var visit func(name string) int
+	visit = func(name string) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		// Configs have no dependency cycles, see config.Config.Validate.
+		d := 0
+		for _, dep := range cfg.Sessions[name].Dependencies() {
+			d = max(d, visit(dep)+1)
+		}
+		depth[name] = d
+		return d
+	}
+
+	var waves [][]string
+	for name := range cfg.Sessions {
+		d := visit(name)
+		for len(waves) <= d {
+			waves = append(waves, nil)
+		}
+		waves[d] = append(waves[d], name)
+	}
+	for _, wave := range waves {
+		sort.Strings(wave)
+	}
+	return waves
+}
+
+// Setup returns the text that prepares a session's shell, by changing to the
+// session's directory and exporting its environment. It is empty if there is
+// nothing to prepare.
+func Setup(sess *config.Session) string {
+	var b strings.Builder
+	if dir := sess.WorkDir(); dir != "" {
+		fmt.Fprintf(&b, "cd %s\n", shell.Quote(dir))
+	}
+	if env := sess.Environment(); len(env) > 0 {
+		b.WriteString("export")
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			fmt.Fprintf(&b, " %s=%s", name, shell.Quote(env[name]))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// DoneFilePattern and ScriptFilePattern are the os.CreateTemp patterns of
+// the files a session's script runs with.
+func DoneFilePattern(session string) string   { return session + "-done-*" }
+func ScriptFilePattern(session string) string { return session + "-script-*" }
+
+// WrapScript returns the wrapper that runs a session's script. It traces the
+// script's commands, and writes the script's exit status to doneFile when
+// the script exits, for any reason.
+func WrapScript(script, doneFile string) string {
+	trap := "echo $? > " + shell.Quote(doneFile)
+	return fmt.Sprintf("trap %s EXIT\n", shell.Quote(trap)) +
+		"set -x\n" +
+		script
+}
+
+// RunScript returns the text that runs the wrapper at scriptFile in a
+// session's shell.
+func RunScript(scriptFile string) string {
+	return fmt.Sprintf("bash %s\n", shell.Quote(scriptFile))
+}
+
+// Inject returns the text that runs a session's inject lines, or "" if it
+// has none.
+func Inject(sess *config.Session) string {
+	if sess.Inject == "" {
+		return ""
+	}
+	return sess.Inject + "\n"
+}
@@ -0,0 +1,144 @@
+package plan
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pglass/iterm-tool/config"
+	"github.com/pglass/iterm-tool/layout"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	cfg, err := config.LoadConfig("data/TestNew.toml")
+	require.NoError(t, err)
+	p := New(cfg)
+
+	require.Equal(t, []Tab{
+		{
+			Window: "test-plan",
+			Layout: &layout.Node{Columns: true, Children: []*layout.Node{
+				{Session: "server", Size: 2},
+				{Children: []*layout.Node{layout.Leaf("db"), layout.Leaf("setup")}},
+			}},
+			Panes: []Pane{
+				{Session: "server"},
+				{Session: "db", SplitFrom: "server", Vertical: true},
+				{Session: "setup", SplitFrom: "db"},
+			},
+		},
+		{
+			Window: "test-plan",
+			Title:  "clients",
+			Layout: layout.Leaf("client"),
+			Panes:  []Pane{{Session: "client"}},
+		},
+	}, p.Tabs)
+
+	require.Equal(t, [][]string{{"db", "setup"}, {"server"}, {"client"}}, p.Waves)
+
+	require.Equal(t, []Session{
+		{Name: "client", DependsOn: []string{"server"}, Setup: "export LOG_LEVEL=debug\n", Inject: "curl localhost:8080\n"},
+		{Name: "db", Setup: "export LOG_LEVEL=debug PORT=5432\n", Inject: "docker compose up db\n"},
+		{Name: "server", DependsOn: []string{"setup", "db"}, Setup: "export LOG_LEVEL=debug\n", Inject: "make serve\n"},
+		{
+			Name:       "setup",
+			Setup:      "export LOG_LEVEL=debug\n",
+			Script:     "trap 'echo $? > '\\''$TMPDIR/setup-done-*'\\''' EXIT\nset -x\nmake build\n",
+			ScriptFile: "$TMPDIR/setup-script-*",
+			RunScript:  "bash '$TMPDIR/setup-script-*'\n",
+			Attempts:   2,
+		},
+	}, p.Sessions)
+}
+
+func TestPrint(t *testing.T) {
+	cfg, err := config.LoadConfig("data/TestNew.toml")
+	require.NoError(t, err)
+
+	var b strings.Builder
+	New(cfg).Print(&b)
+	require.Equal(t, `Window "test-plan", tab 1:
+  Layout:
+    columns
+      server (size 2)
+      rows
+        db
+        setup
+  Panes:
+    1. server
+    2. db, split right of server
+    3. setup, split below db
+
+Window "test-plan", tab 2 "clients":
+  Layout:
+    client
+  Panes:
+    1. client
+
+Waves:
+  1. db, setup
+  2. server
+  3. client
+
+Session "client":
+  Depends on: server
+  Setup:
+    export LOG_LEVEL=debug
+  Inject:
+    curl localhost:8080
+
+Session "db":
+  Setup:
+    export LOG_LEVEL=debug PORT=5432
+  Inject:
+    docker compose up db
+
+Session "server":
+  Depends on: setup, db
+  Setup:
+    export LOG_LEVEL=debug
+  Inject:
+    make serve
+
+Session "setup":
+  Setup:
+    export LOG_LEVEL=debug
+  Script $TMPDIR/setup-script-*, run up to 2 times:
+    trap 'echo $? > '\''$TMPDIR/setup-done-*'\''' EXIT
+    set -x
+    make build
+  Run script:
+    bash '$TMPDIR/setup-script-*'
+`, b.String())
+}
+
+func TestWrapScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+
+		expDone string
+	}{
+		{name: "success", script: "true", expDone: "0\n"},
+		{name: "failure", script: "exit 3", expDone: "3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Temporary files can be in directories whose names need quoting.
+			dir := filepath.Join(t.TempDir(), "it's a $dir")
+			require.NoError(t, os.Mkdir(dir, 0o755))
+			doneFile := filepath.Join(dir, "done")
+			scriptFile := filepath.Join(dir, "script")
+			require.NoError(t, os.WriteFile(scriptFile, []byte(WrapScript(tt.script, doneFile)), 0o644))
+
+			_ = exec.Command("sh", "-c", RunScript(scriptFile)).Run()
+			done, err := os.ReadFile(doneFile)
+			require.NoError(t, err)
+			require.Equal(t, tt.expDone, string(done))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pglass/iterm-tool/layout"
+)
+
+// Print writes the plan for people to read.
+func (p *Plan) Print(w io.Writer) {
+	tabNumbers := map[string]int{}
+	for _, tab := range p.Tabs {
+		tabNumbers[tab.Window]++
+		fmt.Fprintf(w, "Window %q, tab %d", tab.Window, tabNumbers[tab.Window])
+		if tab.Title != "" {
+			fmt.Fprintf(w, " %q", tab.Title)
+		}
+		fmt.Fprintln(w, ":")
+		fmt.Fprintln(w, "  Layout:")
+		printLayout(w, tab.Layout, "    ")
+		fmt.Fprintln(w, "  Panes:")
+		for i, pane := range tab.Panes {
+			fmt.Fprintf(w, "    %d. %s", i+1, pane.Session)
+			switch {
+			case pane.SplitFrom == "":
+			case pane.Vertical:
+				fmt.Fprintf(w, ", split right of %s", pane.SplitFrom)
+			default:
+				fmt.Fprintf(w, ", split below %s", pane.SplitFrom)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "Waves:")
+	for i, wave := range p.Waves {
+		fmt.Fprintf(w, "  %d. %s\n", i+1, strings.Join(wave, ", "))
+	}
+
+	for _, sess := range p.Sessions {
+		fmt.Fprintf(w, "\nSession %q:\n", sess.Name)
+		if len(sess.DependsOn) > 0 {
+			fmt.Fprintf(w, "  Depends on: %s\n", strings.Join(sess.DependsOn, ", "))
+		}
+		printText(w, "Setup", sess.Setup)
+		if sess.Script != "" {
+			printText(w, fmt.Sprintf("Script %s, run up to %d times", sess.ScriptFile, sess.Attempts), sess.Script)
+			printText(w, "Run script", sess.RunScript)
+		}
+		printText(w, "Inject", sess.Inject)
+	}
+}
+
+// printLayout writes the layout tree under n, a node per line.
+func printLayout(w io.Writer, n *layout.Node, indent string) {
+	label := n.Session
+	if len(n.Children) > 0 {
+		label = "rows"
+		if n.Columns {
+			label = "columns"
+		}
+	}
+	if n.Weight() != 1 {
+		label += fmt.Sprintf(" (size %g)", n.Weight())
+	}
+	fmt.Fprintf(w, "%s%s\n", indent, label)
+	for _, child := range n.Children {
+		printLayout(w, child, indent+"  ")
+	}
+}
+
+// printText writes text sent to a session, indented under a heading. The
+// newline that ends the text is left out.
+func printText(w io.Writer, heading, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(w, "  %s:\n", heading)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if line == "" {
+			fmt.Fprintln(w)
+			continue
+		}
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
@@ -0,0 +1,180 @@
+// Package probe tells when a service is ready: a port accepts connections, a
+// URL answers, a file appears, some output shows up, or a command succeeds.
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Probe is a single readiness check.
+type Probe interface {
+	// Check returns nil if the probe passes.
+	Check(ctx context.Context) error
+	String() string
+}
+
+// TCP passes once Address accepts connections.
+type TCP struct {
+	Address string
+}
+
+func (p TCP) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p TCP) String() string {
+	return "tcp " + p.Address
+}
+
+// HTTP passes once a GET of URL returns Status, or any 2xx status if Status is zero.
+type HTTP struct {
+	URL    string
+	Status int
+}
+
+func (p HTTP) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if p.Status == 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == p.Status {
+		return nil
+	}
+	return fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+func (p HTTP) String() string {
+	return "http " + p.URL
+}
+
+// File passes once Path exists.
+type File struct {
+	Path string
+}
+
+func (p File) Check(ctx context.Context) error {
+	_, err := os.Stat(p.Path)
+	return err
+}
+
+func (p File) String() string {
+	return "file " + p.Path
+}
+
+// Match passes once the text returned by Screen matches Pattern.
+type Match struct {
+	Pattern *regexp.Regexp
+	Screen  func(ctx context.Context) (string, error)
+}
+
+func (p Match) Check(ctx context.Context) error {
+	text, err := p.Screen(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.Pattern.MatchString(text) {
+		return errors.New("no match")
+	}
+	return nil
+}
+
+func (p Match) String() string {
+	return "match " + p.Pattern.String()
+}
+
+// Command passes once Command, run with bash, exits with status zero.
+type Command struct {
+	Command string
+	// Dir is the working directory of the command. Empty means the current directory.
+	Dir string
+	// Env sets environment variables for the command, on top of the tool's
+	// own environment.
+	Env map[string]string
+}
+
+func (p Command) Check(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "bash", "-c", p.Command)
+	cmd.Dir = p.Dir
+	if len(p.Env) > 0 {
+		cmd.Env = os.Environ()
+		for name, value := range p.Env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(out)); out != "" {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p Command) String() string {
+	return "command " + p.Command
+}
+
+// Wait checks the probes every interval until all of them have passed, or
+// until timeout. A probe that passed once is not checked again.
+func Wait(ctx context.Context, probes []Probe, interval, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		probe Probe
+		err   error
+	}
+	var pending []result
+	for _, p := range probes {
+		pending = append(pending, result{probe: p})
+	}
+	for {
+		var failing []result
+		for _, r := range pending {
+			if r.err = r.probe.Check(ctx); r.err != nil {
+				failing = append(failing, r)
+			}
+		}
+		pending = failing
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return ctx.Err()
+			}
+			var errs []error
+			for _, r := range pending {
+				errs = append(errs, fmt.Errorf("%s: %w", r.probe, r.err))
+			}
+			return fmt.Errorf("not ready after %s: %w", timeout, errors.Join(errs...))
+		case <-time.After(interval):
+		}
+	}
+}
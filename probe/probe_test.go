@@ -0,0 +1,93 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ready"), nil, 0o644))
+
+	screen := func(context.Context) (string, error) {
+		return "booting\nListening on :8080\n", nil
+	}
+
+	tests := []struct {
+		name     string
+		probe    Probe
+		expError string
+	}{
+		{name: "tcp", probe: TCP{Address: listener.Addr().String()}},
+		{name: "tcp-closed", probe: TCP{Address: closedAddress(t)}, expError: "refused"},
+		{name: "http", probe: HTTP{URL: srv.URL}},
+		{name: "http-status", probe: HTTP{URL: srv.URL + "/missing", Status: 404}},
+		{name: "http-wrong-status", probe: HTTP{URL: srv.URL + "/missing"}, expError: "unexpected status 404 Not Found"},
+		{name: "file", probe: File{Path: filepath.Join(dir, "ready")}},
+		{name: "file-missing", probe: File{Path: filepath.Join(dir, "missing")}, expError: "no such file"},
+		{name: "match", probe: Match{Pattern: regexp.MustCompile(`Listening on :\d+`), Screen: screen}},
+		{name: "match-missing", probe: Match{Pattern: regexp.MustCompile(`Ready`), Screen: screen}, expError: "no match"},
+		{name: "command", probe: Command{Command: "test -f ready", Dir: dir}},
+		{name: "command-fails", probe: Command{Command: "echo nope; exit 3"}, expError: "exit status 3: nope"},
+		{name: "command-env", probe: Command{Command: `test -n "$PATH" && test "$PORT" = 5432`, Env: map[string]string{"PORT": "5432"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.probe.Check(context.Background())
+			if len(tt.expError) != 0 {
+				require.ErrorContains(t, err, tt.expError)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ready")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(path, nil, 0o644)
+	}()
+	err := Wait(context.Background(), []Probe{File{Path: path}}, 10*time.Millisecond, 5*time.Second)
+	require.NoError(t, err)
+}
+
+func TestWaitTimeout(t *testing.T) {
+	dir := t.TempDir()
+	err := Wait(context.Background(), []Probe{
+		File{Path: dir},
+		File{Path: filepath.Join(dir, "missing")},
+	}, 10*time.Millisecond, 50*time.Millisecond)
+	require.ErrorContains(t, err, "not ready after 50ms")
+	require.ErrorContains(t, err, "file "+filepath.Join(dir, "missing"))
+	require.NotContains(t, err.Error(), "file "+dir+":")
+}
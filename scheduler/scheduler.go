@@ -0,0 +1,313 @@
+// Package scheduler runs tasks that depend on each other, starting each one
+// as soon as the tasks it depends on are ready.
+//
+// A task is ready when it says so, or when it finishes successfully. That
+// lets a long-running task, like a server, unblock its dependents without
+// finishing.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pglass/iterm-tool/dag"
+)
+
+// Task is a unit of work.
+type Task struct {
+	Name      string
+	DependsOn []string
+	// Run does the work. It may call ready to let dependents start before it
+	// returns. Returning nil implies ready.
+	Run func(ctx context.Context, ready func()) error
+	// ContinueOnFailure keeps the scheduler starting tasks that do not depend
+	// on this one if it fails. Otherwise, a failure stops the run: no new
+	// tasks start, and Run waits for the running ones.
+	ContinueOnFailure bool
+}
+
+// EventType says what happened to a task.
+type EventType int
+
+const (
+	// Queued is sent for every task before any starts.
+	Queued EventType = iota
+	Started
+	Ready
+	Done
+	Failed
+	// Skipped tasks never started, because a dependency failed or the run stopped.
+	Skipped
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Queued:
+		return "queued"
+	case Started:
+		return "started"
+	case Ready:
+		return "ready"
+	case Done:
+		return "done"
+	case Failed:
+		return "failed"
+	case Skipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event reports a change in a task's state.
+type Event struct {
+	Type EventType
+	Task string
+	Time time.Time
+	// Err is why the task failed or was skipped.
+	Err error
+}
+
+// Status is where a task ended up.
+type Status int
+
+const (
+	StatusSkipped Status = iota
+	StatusSucceeded
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSkipped:
+		return "skipped"
+	case StatusSucceeded:
+		return "succeeded"
+	case StatusFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Result is the outcome of one task.
+type Result struct {
+	Name   string
+	Status Status
+	// Err is why the task failed or was skipped.
+	Err error
+	// Start, Ready and End are zero for tasks that did not get that far.
+	Start time.Time
+	Ready time.Time
+	End   time.Time
+}
+
+// Options tune a run.
+type Options struct {
+	// MaxParallel limits how many tasks run at once. Zero means no limit.
+	MaxParallel int
+	// OnEvent, if set, is called for every event. Calls are not concurrent,
+	// and events for a task arrive in order.
+	OnEvent func(Event)
+}
+
+// ErrDependencyFailed is wrapped by the Err of tasks skipped because a dependency failed.
+var ErrDependencyFailed = errors.New("dependency failed")
+
+// ErrStopped is wrapped by the Err of tasks skipped because another task
+// failed and stopped the run, or because ctx was canceled.
+var ErrStopped = errors.New("run stopped")
+
+// Check reports unknown dependencies, duplicate names and dependency cycles,
+// which Run refuses.
+func Check(tasks []Task) error {
+	byName := map[string]*Task{}
+	for i := range tasks {
+		t := &tasks[i]
+		if _, ok := byName[t.Name]; ok {
+			return fmt.Errorf("duplicate task %q", t.Name)
+		}
+		byName[t.Name] = t
+	}
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("task %q depends on unknown task %q", t.Name, dep)
+			}
+		}
+	}
+
+	return dag.FindCycle(taskNames(tasks), func(name string) []string {
+		return byName[name].DependsOn
+	})
+}
+
+func taskNames(tasks []Task) []string {
+	var result []string
+	for _, t := range tasks {
+		result = append(result, t.Name)
+	}
+	return result
+}
+
+type state int
+
+const (
+	pending state = iota
+	running
+	ready
+	finished
+)
+
+// update is sent by a task's goroutine.
+type update struct {
+	name     string
+	finished bool
+	err      error
+}
+
+// Run runs the tasks and returns their results, in the order of tasks.
+// Tasks start in the order given, as their dependencies allow.
+//
+// Run returns an error only if the tasks cannot be scheduled; failed
+// tasks are reported in the results.
+func Run(ctx context.Context, tasks []Task, opts Options) ([]Result, error) {
+	if err := Check(tasks); err != nil {
+		return nil, err
+	}
+
+	emit := func(typ EventType, name string, err error) time.Time {
+		now := time.Now()
+		if opts.OnEvent != nil {
+			opts.OnEvent(Event{Type: typ, Task: name, Time: now, Err: err})
+		}
+		return now
+	}
+
+	results := make([]Result, len(tasks))
+	index := map[string]int{}
+	states := make([]state, len(tasks))
+	for i, t := range tasks {
+		index[t.Name] = i
+		results[i] = Result{Name: t.Name}
+		emit(Queued, t.Name, nil)
+	}
+
+	updates := make(chan update)
+	numRunning := 0
+	var stopErr error
+
+	skip := func(i int, err error) {
+		states[i] = finished
+		results[i].Status = StatusSkipped
+		results[i].Err = err
+		emit(Skipped, tasks[i].Name, err)
+	}
+
+	for {
+		if stopErr == nil && ctx.Err() != nil {
+			stopErr = fmt.Errorf("%w: %w", ErrStopped, ctx.Err())
+		}
+
+		// Skip tasks that can never run. Skipping a task can doom its
+		// dependents, so repeat until nothing changes.
+		for changed := true; changed; {
+			changed = false
+			for i, t := range tasks {
+				if states[i] != pending {
+					continue
+				}
+				for _, dep := range t.DependsOn {
+					d := index[dep]
+					if states[d] == finished && results[d].Status != StatusSucceeded {
+						skip(i, fmt.Errorf("%w: %q", ErrDependencyFailed, dep))
+						changed = true
+						break
+					}
+				}
+			}
+		}
+		if stopErr != nil {
+			for i := range tasks {
+				if states[i] == pending {
+					skip(i, stopErr)
+				}
+			}
+		}
+
+		// Start the tasks whose dependencies are ready.
+		for i, t := range tasks {
+			if states[i] != pending {
+				continue
+			}
+			if opts.MaxParallel > 0 && numRunning >= opts.MaxParallel {
+				break
+			}
+			if !slices.ContainsFunc(t.DependsOn, func(dep string) bool {
+				return states[index[dep]] < ready
+			}) {
+				states[i] = running
+				numRunning++
+				results[i].Start = emit(Started, t.Name, nil)
+				go runTask(ctx, t, updates)
+			}
+		}
+
+		if numRunning == 0 {
+			if i := slices.Index(states, pending); i >= 0 {
+				// Check rules out cycles, so this is a bug.
+				return results, fmt.Errorf("[bug] deadlock: task %q cannot start", tasks[i].Name)
+			}
+			return results, nil
+		}
+
+		u := <-updates
+		i := index[u.name]
+		t := tasks[i]
+		if !u.finished {
+			states[i] = ready
+			results[i].Ready = emit(Ready, t.Name, nil)
+			continue
+		}
+
+		numRunning--
+		states[i] = finished
+		if u.err != nil {
+			results[i].Status = StatusFailed
+			results[i].Err = u.err
+			results[i].End = emit(Failed, t.Name, u.err)
+			if !t.ContinueOnFailure && stopErr == nil {
+				stopErr = fmt.Errorf("%w: %q failed", ErrStopped, t.Name)
+			}
+			continue
+		}
+		results[i].Status = StatusSucceeded
+		results[i].End = emit(Done, t.Name, nil)
+	}
+}
+
+func runTask(ctx context.Context, t Task, updates chan<- update) {
+	// ready sends at most one update, and never after the task finished.
+	var mu sync.Mutex
+	sentReady := false
+	ready := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !sentReady {
+			sentReady = true
+			updates <- update{name: t.Name}
+		}
+	}
+
+	err := t.Run(ctx, ready)
+	if err == nil {
+		ready()
+	} else {
+		mu.Lock()
+		sentReady = true
+		mu.Unlock()
+	}
+	updates <- update{name: t.Name, finished: true, err: err}
+}
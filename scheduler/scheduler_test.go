@@ -0,0 +1,216 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects events as "<type> <task>" strings.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf("%s %s", e.Type, e.Task))
+}
+
+func (r *recorder) index(event string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+func succeed(context.Context, func()) error { return nil }
+
+func fail(context.Context, func()) error { return errors.New("boom") }
+
+func statuses(results []Result) map[string]Status {
+	m := map[string]Status{}
+	for _, r := range results {
+		m[r.Name] = r.Status
+	}
+	return m
+}
+
+func TestRunStartsTasksWhenDependenciesAreReady(t *testing.T) {
+	release := make(chan struct{})
+	var rec recorder
+	results, err := Run(context.Background(), []Task{
+		{Name: "slow", Run: func(ctx context.Context, ready func()) error {
+			<-release
+			return nil
+		}},
+		{Name: "setup", Run: succeed},
+		{Name: "server", DependsOn: []string{"setup"}, Run: func(ctx context.Context, ready func()) error {
+			ready()
+			// Keep running until the client is done, like a server would.
+			<-release
+			return nil
+		}},
+		{Name: "client", DependsOn: []string{"server"}, Run: func(ctx context.Context, ready func()) error {
+			close(release)
+			return nil
+		}},
+	}, Options{OnEvent: rec.record})
+	require.NoError(t, err)
+	require.Equal(t, map[string]Status{"slow": StatusSucceeded, "setup": StatusSucceeded, "server": StatusSucceeded, "client": StatusSucceeded}, statuses(results))
+
+	// The client started while slow and server were still running.
+	require.Less(t, rec.index("ready server"), rec.index("started client"))
+	require.Less(t, rec.index("started client"), rec.index("done server"))
+	require.Less(t, rec.index("started client"), rec.index("done slow"))
+	require.Less(t, rec.index("ready setup"), rec.index("started server"))
+	for _, r := range results {
+		require.False(t, r.Start.IsZero())
+		require.False(t, r.Ready.Before(r.Start))
+		require.False(t, r.End.Before(r.Ready))
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	tests := []struct {
+		name              string
+		continueOnFailure bool
+		expStatuses       map[string]Status
+	}{
+		{
+			name: "stop",
+			expStatuses: map[string]Status{
+				"setup": StatusFailed, "server": StatusSkipped, "client": StatusSkipped, "other": StatusSkipped,
+			},
+		},
+		{
+			name:              "continue",
+			continueOnFailure: true,
+			expStatuses: map[string]Status{
+				"setup": StatusFailed, "server": StatusSkipped, "client": StatusSkipped, "other": StatusSucceeded,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec recorder
+			// One at a time, so that setup fails before other could start.
+			results, err := Run(context.Background(), []Task{
+				{Name: "setup", Run: fail, ContinueOnFailure: tt.continueOnFailure},
+				{Name: "client", DependsOn: []string{"server"}, Run: succeed},
+				{Name: "server", DependsOn: []string{"setup"}, Run: succeed},
+				{Name: "other", Run: succeed},
+			}, Options{OnEvent: rec.record, MaxParallel: 1})
+			require.NoError(t, err)
+			require.Equal(t, tt.expStatuses, statuses(results))
+
+			require.EqualError(t, results[0].Err, "boom")
+			require.ErrorIs(t, results[1].Err, ErrDependencyFailed)
+			require.ErrorIs(t, results[2].Err, ErrDependencyFailed)
+			require.NotEqual(t, -1, rec.index("failed setup"))
+			require.NotEqual(t, -1, rec.index("skipped client"))
+			require.Equal(t, -1, rec.index("started server"))
+			if !tt.continueOnFailure {
+				require.ErrorIs(t, results[3].Err, ErrStopped)
+			}
+		})
+	}
+}
+
+func TestRunMaxParallel(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	task := func(ctx context.Context, ready func()) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	var tasks []Task
+	for i := 0; i < 8; i++ {
+		tasks = append(tasks, Task{Name: fmt.Sprint(i), Run: task})
+	}
+	results, err := Run(context.Background(), tasks, Options{MaxParallel: 3})
+	require.NoError(t, err)
+	require.Len(t, results, 8)
+	require.EqualValues(t, 3, maxRunning.Load())
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := Run(ctx, []Task{
+		{Name: "server", ContinueOnFailure: true, Run: func(ctx context.Context, ready func()) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{Name: "other", Run: succeed},
+	}, Options{MaxParallel: 1})
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, context.Canceled)
+	require.Equal(t, StatusSkipped, results[1].Status)
+	require.ErrorIs(t, results[1].Err, ErrStopped)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    []Task
+		expError string
+	}{
+		{
+			name: "ok",
+			tasks: []Task{
+				{Name: "a"},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "c", DependsOn: []string{"a", "b"}},
+			},
+		},
+		{
+			name:     "unknown",
+			tasks:    []Task{{Name: "a", DependsOn: []string{"b"}}},
+			expError: `task "a" depends on unknown task "b"`,
+		},
+		{
+			name:     "duplicate",
+			tasks:    []Task{{Name: "a"}, {Name: "a"}},
+			expError: `duplicate task "a"`,
+		},
+		{
+			name: "cycle",
+			tasks: []Task{
+				{Name: "a", DependsOn: []string{"c"}},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "c", DependsOn: []string{"b"}},
+			},
+			expError: `dependency cycle: a -> c -> b -> a`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.tasks)
+			if len(tt.expError) != 0 {
+				require.EqualError(t, err, tt.expError)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
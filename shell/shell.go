@@ -0,0 +1,26 @@
+// Package shell builds text for POSIX shells.
+package shell
+
+import "strings"
+
+// Quote returns s quoted for a POSIX shell, so that the shell reads it as a
+// single word with the same value. Words that need no quoting are returned
+// as is.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, needsQuote) < 0 {
+		return s
+	}
+	// Nothing is special inside single quotes, except the single quote itself.
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func needsQuote(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("@%+=:,./-_", r)
+}
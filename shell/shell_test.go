@@ -0,0 +1,35 @@
+package shell
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp string
+	}{
+		{in: "", exp: "''"},
+		{in: "plain", exp: "plain"},
+		{in: "/usr/local/bin:./bin", exp: "/usr/local/bin:./bin"},
+		{in: "two words", exp: "'two words'"},
+		{in: "it's", exp: `'it'\''s'`},
+		{in: "$HOME", exp: "'$HOME'"},
+		{in: "~/code", exp: "'~/code'"},
+		{in: "a\nb", exp: "'a\nb'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			quoted := Quote(tt.in)
+			require.Equal(t, tt.exp, quoted)
+
+			// The shell reads it back unchanged.
+			out, err := exec.Command("sh", "-c", "printf %s "+quoted).Output()
+			require.NoError(t, err)
+			require.Equal(t, tt.in, string(out))
+		})
+	}
+}
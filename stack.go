@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/pglass/iterm-tool/backend"
+	"github.com/pglass/iterm-tool/config"
+	"github.com/pglass/iterm-tool/plan"
+	"github.com/pglass/iterm-tool/scheduler"
+)
+
+// stack tracks the windows and panes of a config, and records them in the
+// cache so a later run can find them.
+type stack struct {
+	term   backend.Backend
+	cfg    *config.Config
+	cache  *Cache
+	cached CacheEntry
+
+	// windows are the windows of the config, by name.
+	windows map[string]backend.Window
+	// panes are the panes of the sessions, by session name.
+	panes map[string]backend.Pane
+}
+
+func newStack(term backend.Backend, cfg *config.Config, cache *Cache) (*stack, error) {
+	cached, err := cache.Get(cfg.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &stack{
+		term:    term,
+		cfg:     cfg,
+		cache:   cache,
+		cached:  cached,
+		windows: map[string]backend.Window{},
+		panes:   map[string]backend.Pane{},
+	}, nil
+}
+
+// build closes the windows of an earlier run, if any, and creates all the
+// windows, tabs and panes of the config from scratch.
+func (s *stack) build(ctx context.Context) error {
+	for _, id := range s.cached.Windows() {
+		slog.Info("closing existing window", "id", id)
+		if err := s.term.CloseWindow(ctx, id); err != nil {
+			return fmt.Errorf("closing existing window: %w", err)
+		}
+	}
+	// Keep the records of the sessions, for their timings.
+	s.cached = CacheEntry{Sessions: s.cached.Sessions}
+
+	for _, place := range s.cfg.Places() {
+		if err := s.openTab(ctx, place); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openTab creates the tab at place, and splits it into the panes of its
+// sessions. The first tab of a window comes with the window, and the window
+// is created if it does not exist yet.
+func (s *stack) openTab(ctx context.Context, place config.Place) error {
+	window, ok := s.windows[place.Window]
+	var tab backend.Tab
+	if ok {
+		var err error
+		tab, err = window.CreateTab(ctx)
+		if err != nil {
+			return fmt.Errorf("create tab: %w", err)
+		}
+	} else {
+		window, err := s.term.CreateWindow(ctx, s.cfg.WindowTitle(place.Window))
+		if err != nil {
+			return fmt.Errorf("create window: %w", err)
+		}
+		s.windows[place.Window] = window
+
+		// Record the window right away, so that it is closed by the next
+		// run even if this one does not get further.
+		s.cached.WindowIDs = append(s.cached.WindowIDs, window.ID())
+		if err := s.cache.Put(s.cfg.ID, s.cached); err != nil {
+			return fmt.Errorf("write cache: %w", err)
+		}
+		slog.Info("created window", "id", window.ID(), "name", place.Window)
+
+		tabs, err := window.ListTabs(ctx)
+		if err != nil {
+			return fmt.Errorf("list tabs: %w", err)
+		}
+		if len(tabs) == 0 {
+			return fmt.Errorf("no tabs in window %s", window.ID())
+		}
+		tab = tabs[0]
+	}
+	if title := s.cfg.TabTitle(place); title != "" {
+		if err := tab.SetTitle(ctx, title); err != nil {
+			return fmt.Errorf("set tab title: %w", err)
+		}
+	}
+
+	panes, err := arrange(ctx, tab, s.cfg.LayoutTree(place), s.cfg.TabLayout(place) != nil)
+	if err != nil {
+		return fmt.Errorf("arrange panes: %w", err)
+	}
+	maps.Copy(s.panes, panes)
+	return nil
+}
+
+// restart starts the shells of the panes of names over, to stop what they
+// were running. It returns the sessions whose pane cannot restart, which
+// start must interrupt instead.
+func (s *stack) restart(ctx context.Context, names []string) (interrupt map[string]bool, err error) {
+	interrupt = map[string]bool{}
+	for _, name := range names {
+		r, ok := s.panes[name].(backend.Restarter)
+		if !ok {
+			interrupt[name] = true
+			continue
+		}
+		slog.Info("restarting pane", "name", name, "id", s.panes[name].ID())
+		if err := r.Restart(ctx); err != nil {
+			return nil, fmt.Errorf("restart pane: %w", err)
+		}
+	}
+	return interrupt, nil
+}
+
+// save records the pane of each session that has one in the cache, with
+// what it runs. Records of sessions that are no longer in the config are
+// dropped.
+func (s *stack) save() error {
+	if s.cached.Sessions == nil {
+		s.cached.Sessions = map[string]CachedSession{}
+	}
+	for name := range s.cached.Sessions {
+		if _, ok := s.cfg.Sessions[name]; !ok {
+			delete(s.cached.Sessions, name)
+		}
+	}
+	for name, pane := range s.panes {
+		sess := s.cfg.Sessions[name]
+		rec := s.cached.Sessions[name]
+		rec.PaneID, rec.Window, rec.Tab, rec.Hash = pane.ID(), sess.Window, sess.Tab, sess.Hash()
+		s.cached.Sessions[name] = rec
+	}
+	return s.cache.Put(s.cfg.ID, s.cached)
+}
+
+// saveTimings records how long each session that ran successfully took to be
+// ready. Sessions in keep were left running, and keep their timings.
+func (s *stack) saveTimings(results []scheduler.Result, keep map[string]bool) error {
+	for _, r := range results {
+		rec, ok := s.cached.Sessions[r.Name]
+		if !ok || keep[r.Name] || r.Status != scheduler.StatusSucceeded {
+			continue
+		}
+		rec.ReadyAfter = r.Ready.Sub(r.Start)
+		s.cached.Sessions[r.Name] = rec
+	}
+	return s.cache.Put(s.cfg.ID, s.cached)
+}
+
+// start runs the sessions in names in their panes, each as soon as the
+// sessions it depends on are ready. Dependencies on sessions outside names
+// are taken to be ready. Sessions in keep are left running as they are.
+// Sessions in interrupt are interrupted first, to stop what they were
+// running.
+func (s *stack) start(ctx context.Context, names []string, keep, interrupt map[string]bool, maxParallel int) ([]scheduler.Result, error) {
+	setupCtx, cancelSetup := context.WithTimeout(ctx, setupTimeout)
+	defer cancelSetup()
+
+	// Prep sessions.
+	// - Navigate to a specified directory.
+	// - Export environment variables, so that scripts and inject lines see them.
+	for _, name := range names {
+		sess, ok := s.panes[name]
+		if !ok {
+			return nil, fmt.Errorf("[bug] no assigned session: name=%s", name)
+		}
+		if keep[name] {
+			continue
+		}
+		if interrupt[name] {
+			slog.Info("interrupting session", "name", name)
+			if err := sess.SendText(setupCtx, "\x03"); err != nil {
+				return nil, fmt.Errorf("send text: %w", err)
+			}
+		}
+		if err := sess.SetName(setupCtx, name); err != nil {
+			return nil, fmt.Errorf("set session name: %w", err)
+		}
+		if setup := plan.Setup(s.cfg.Sessions[name]); setup != "" {
+			if err := sess.SendText(setupCtx, setup); err != nil {
+				return nil, fmt.Errorf("send text: %w", err)
+			}
+		}
+	}
+
+	// Start each session as soon as the sessions it depends on are ready.
+	var tasks []scheduler.Task
+	for _, name := range names {
+		scfg := s.cfg.Sessions[name]
+		sess := s.panes[name]
+		var deps []string
+		for _, dep := range scfg.Dependencies() {
+			if slices.Contains(names, dep) {
+				deps = append(deps, dep)
+			}
+		}
+		tasks = append(tasks, scheduler.Task{
+			Name:              name,
+			DependsOn:         deps,
+			ContinueOnFailure: scfg.FailurePolicy() == config.OnFailureContinue,
+			Run: func(ctx context.Context, ready func()) error {
+				if keep[name] {
+					slog.Info("session unchanged, leaving it running", "name", name)
+					return nil
+				}
+				return runSession(ctx, sess, scfg)
+			},
+		})
+	}
+	return scheduler.Run(ctx, tasks, scheduler.Options{
+		MaxParallel: maxParallel,
+		OnEvent:     logEvent,
+	})
+}
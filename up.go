@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/pglass/iterm-tool/backend"
+	"github.com/pglass/iterm-tool/config"
+	"github.com/pglass/iterm-tool/layout"
+)
+
+// foundPane is a pane in a window of an earlier run.
+type foundPane struct {
+	pane   backend.Pane
+	tab    backend.Tab
+	window backend.Window
+}
+
+// reconcile updates the windows of an earlier run to match the config,
+// instead of starting over:
+//
+//   - Sessions are matched to panes, see match.
+//   - Sessions whose hash is unchanged are left running. They are returned
+//     as unchanged.
+//   - Sessions that changed are restarted in their pane, see restart. Those
+//     whose pane cannot restart are returned in interrupt.
+//   - Sessions without a pane get a new one, in a new tab or window if need
+//     be.
+//   - Panes of sessions that were removed, or moved to another tab, are
+//     closed.
+func (s *stack) reconcile(ctx context.Context) (unchanged, interrupt map[string]bool, err error) {
+	matched, err := s.match(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unchanged = map[string]bool{}
+	var changed []string
+	tabs := map[config.Place]backend.Tab{}
+	var stale []string
+	for _, name := range slices.Sorted(maps.Keys(matched)) {
+		f := matched[name]
+		sess, ok := s.cfg.Sessions[name]
+		rec, recorded := s.cached.Sessions[name]
+		if ok && !recorded {
+			// Sessions of caches that predate places are in their place.
+			rec = CachedSession{Window: sess.Window, Tab: sess.Tab}
+		}
+		if !ok || sess.Place() != (config.Place{Window: rec.Window, Tab: rec.Tab}) || f.pane.Alive(ctx) != nil {
+			stale = append(stale, name)
+			continue
+		}
+		s.windows[rec.Window] = f.window
+		tabs[sess.Place()] = f.tab
+		s.panes[name] = f.pane
+		if rec.Hash == sess.Hash() {
+			unchanged[name] = true
+		} else {
+			changed = append(changed, name)
+		}
+	}
+	if interrupt, err = s.restart(ctx, changed); err != nil {
+		return nil, nil, err
+	}
+
+	// Add the missing panes.
+	var resize []config.Place
+	for _, place := range s.cfg.Places() {
+		tab, ok := tabs[place]
+		if !ok {
+			if err := s.openTab(ctx, place); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err := s.extend(ctx, s.cfg.LayoutTree(place)); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := tab.(backend.Resizer); ok && s.cfg.TabLayout(place) != nil {
+			resize = append(resize, place)
+		}
+	}
+
+	// Close panes last, since closing the last pane of a tab closes the tab.
+	for _, name := range stale {
+		slog.Info("closing pane of removed or moved session", "name", name, "id", matched[name].pane.ID())
+		if err := matched[name].pane.Close(ctx); err != nil {
+			return nil, nil, fmt.Errorf("close pane: %w", err)
+		}
+	}
+	for _, place := range resize {
+		root := s.cfg.LayoutTree(place)
+		if err := tabs[place].(backend.Resizer).Resize(ctx, root, s.panes); err != nil {
+			return nil, nil, fmt.Errorf("resize panes: %w", err)
+		}
+	}
+	return unchanged, interrupt, nil
+}
+
+// match finds the panes of sessions in the windows of an earlier run, by the
+// pane id recorded for the session, or else by the name of the pane. It
+// includes sessions that are no longer in the config.
+func (s *stack) match(ctx context.Context) (map[string]foundPane, error) {
+	found, err := s.findPanes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := map[string]foundPane{}
+	claimed := map[string]bool{}
+	for _, name := range slices.Sorted(maps.Keys(s.cached.Sessions)) {
+		if f, ok := found[s.cached.Sessions[name].PaneID]; ok {
+			matched[name] = f
+			claimed[f.pane.ID()] = true
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(found)) {
+		f := found[id]
+		if claimed[id] {
+			continue
+		}
+		name, err := f.pane.Name(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get pane name: %w", err)
+		}
+		if _, ok := matched[name]; !ok && name != "" {
+			matched[name] = f
+		}
+	}
+	return matched, nil
+}
+
+// findPanes returns the panes in the windows of an earlier run, by pane id.
+// Windows that are gone are dropped from the cache.
+func (s *stack) findPanes(ctx context.Context) (map[string]foundPane, error) {
+	found := map[string]foundPane{}
+	var windowIDs []string
+	for _, id := range s.cached.Windows() {
+		window, err := s.term.FindWindow(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("find window: %w", err)
+		}
+		if window == nil {
+			slog.Info("existing window is gone", "id", id)
+			continue
+		}
+		windowIDs = append(windowIDs, id)
+
+		tabs, err := window.ListTabs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list tabs: %w", err)
+		}
+		for _, tab := range tabs {
+			panes, err := tab.ListPanes(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("list sessions: %w", err)
+			}
+			for _, pane := range panes {
+				found[pane.ID()] = foundPane{pane: pane, tab: tab, window: window}
+			}
+		}
+	}
+	s.cached.WindowID, s.cached.WindowIDs = "", windowIDs
+	return found, nil
+}
+
+// extend adds panes for the sessions of root that have none, to a tab that
+// has panes for some of them. New panes are split from the pane they would
+// have been split from by arrange, or else from the first pane of the tab.
+func (s *stack) extend(ctx context.Context, root *layout.Node) error {
+	var first backend.Pane
+	for _, name := range root.Sessions() {
+		if pane, ok := s.panes[name]; ok {
+			first = pane
+			break
+		}
+	}
+	if first == nil {
+		return fmt.Errorf("[bug] no pane in tab of %s", root.Sessions()[0])
+	}
+
+	add := func(name string, from backend.Pane, vertical bool) error {
+		pane, err := from.Split(ctx, vertical)
+		if err != nil {
+			return fmt.Errorf("split pane: %w", err)
+		}
+		s.panes[name] = pane
+		slog.Info("assigned new session", "name", name, "vertical", vertical)
+		return nil
+	}
+	if _, ok := s.panes[root.Sessions()[0]]; !ok {
+		if err := add(root.Sessions()[0], first, false); err != nil {
+			return err
+		}
+	}
+	for _, split := range layout.Splits(root) {
+		if _, ok := s.panes[split.To]; ok {
+			continue
+		}
+		if err := add(split.To, s.panes[split.From], split.Vertical); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pglass/iterm-tool/backend"
+	"github.com/pglass/iterm-tool/config"
+	"github.com/pglass/iterm-tool/scheduler"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBackend returns a pty backend, and a cache in a temporary home.
+func newTestBackend(t *testing.T) (backend.Backend, *Cache) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SHELL", "bash")
+	term, err := backend.New(backend.Pty, backend.Options{LogDir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { term.Close() })
+	cache, err := NewCache()
+	require.NoError(t, err)
+	return term, cache
+}
+
+// startStack runs the sessions of s, like up does, and checks they all
+// succeeded.
+func startStack(t *testing.T, s *stack, unchanged, interrupt map[string]bool) {
+	require.NoError(t, s.save())
+	results, err := s.start(context.Background(), slices.Sorted(maps.Keys(s.cfg.Sessions)), unchanged, interrupt, 0)
+	require.NoError(t, err)
+	for _, r := range results {
+		require.Equal(t, scheduler.StatusSucceeded, r.Status, "session %s: %v", r.Name, r.Err)
+	}
+	require.NoError(t, s.saveTimings(results, unchanged))
+}
+
+// openPanes returns the ids of the panes in the given windows.
+func openPanes(t *testing.T, term backend.Backend, windowIDs []string) map[string]bool {
+	ctx := context.Background()
+	ids := map[string]bool{}
+	for _, id := range windowIDs {
+		window, err := term.FindWindow(ctx, id)
+		require.NoError(t, err)
+		require.NotNil(t, window, "window %s", id)
+		tabs, err := window.ListTabs(ctx)
+		require.NoError(t, err)
+		for _, tab := range tabs {
+			panes, err := tab.ListPanes(ctx)
+			require.NoError(t, err)
+			for _, pane := range panes {
+				ids[pane.ID()] = true
+			}
+		}
+	}
+	return ids
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name string
+		// edited is the config of the second run, instead of the first one.
+		edited string
+		// exit are sessions whose shell exits before the second run.
+		exit []string
+
+		expUnchanged []string
+		expRestarted []string
+		expAdded     []string
+		expClosed    []string
+	}{
+		{
+			name:         "unchanged",
+			expUnchanged: []string{"a", "b"},
+		},
+		{
+			name:         "changed",
+			edited:       "changed",
+			expUnchanged: []string{"a"},
+			expRestarted: []string{"b"},
+		},
+		{
+			name:         "added",
+			edited:       "added",
+			expUnchanged: []string{"a", "b"},
+			expAdded:     []string{"c"},
+		},
+		{
+			name:         "removed",
+			edited:       "removed",
+			expUnchanged: []string{"a"},
+			expClosed:    []string{"b"},
+		},
+		{
+			name:         "moved to another tab",
+			edited:       "moved",
+			expUnchanged: []string{"a"},
+			expAdded:     []string{"b"},
+			expClosed:    []string{"b"},
+		},
+		{
+			name:         "added in another window",
+			edited:       "window",
+			expUnchanged: []string{"a", "b"},
+			expAdded:     []string{"c"},
+		},
+		{
+			name:         "exited",
+			exit:         []string{"b"},
+			expUnchanged: []string{"a"},
+			expAdded:     []string{"b"},
+			expClosed:    []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term, cache := newTestBackend(t)
+			ctx := context.Background()
+
+			cfg, err := config.LoadConfig("data/TestReconcile.toml")
+			require.NoError(t, err)
+			first, err := newStack(term, cfg, cache)
+			require.NoError(t, err)
+			require.NoError(t, first.build(ctx))
+			startStack(t, first, nil, nil)
+			for _, name := range tt.exit {
+				pane := first.panes[name]
+				require.NoError(t, pane.SendText(ctx, "exit\n"))
+				require.Eventually(t, func() bool { return pane.Alive(ctx) != nil }, 5*time.Second, 50*time.Millisecond)
+			}
+
+			edited := "data/TestReconcile.toml"
+			if tt.edited != "" {
+				edited = fmt.Sprintf("data/TestReconcile_%s.toml", tt.edited)
+			}
+			cfg, err = config.LoadConfig(edited)
+			require.NoError(t, err)
+			second, err := newStack(term, cfg, cache)
+			require.NoError(t, err)
+			unchanged, interrupt, err := second.reconcile(ctx)
+			require.NoError(t, err)
+			startStack(t, second, unchanged, interrupt)
+
+			// The pty backend cannot restart shells, so changed sessions
+			// are interrupted.
+			require.ElementsMatch(t, tt.expUnchanged, slices.Sorted(maps.Keys(unchanged)))
+			require.ElementsMatch(t, tt.expRestarted, slices.Sorted(maps.Keys(interrupt)))
+
+			open := openPanes(t, term, second.cached.Windows())
+			var added, closed []string
+			for name, pane := range second.panes {
+				if old, ok := first.panes[name]; !ok || old.ID() != pane.ID() {
+					added = append(added, name)
+				}
+				require.True(t, open[pane.ID()], "pane of %s is not open", name)
+			}
+			for name, pane := range first.panes {
+				if !open[pane.ID()] {
+					closed = append(closed, name)
+				}
+			}
+			require.ElementsMatch(t, tt.expAdded, added)
+			require.ElementsMatch(t, tt.expClosed, closed)
+			require.Len(t, open, len(cfg.Sessions))
+
+			// The next run finds the panes of this one.
+			entry, err := cache.Get(cfg.ID)
+			require.NoError(t, err)
+			require.Len(t, entry.Sessions, len(cfg.Sessions))
+			for name, pane := range second.panes {
+				require.Equal(t, pane.ID(), entry.Sessions[name].PaneID)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pglass/iterm-tool/config"
+)
+
+// validate prints every problem in the config files, one per line as
+// file:line:column: message or else as a JSON array, and reports whether
+// there were none.
+func validate(w io.Writer, paths []string, asJSON bool) bool {
+	problems := config.Check(paths...)
+	if asJSON {
+		if problems == nil {
+			problems = []config.Problem{}
+		}
+		printJSON(w, problems)
+		return len(problems) == 0
+	}
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	return len(problems) == 0
+}
+
+// printSchema prints the JSON Schema of config files.
+func printSchema(w io.Writer) error {
+	return printJSON(w, config.Schema())
+}